@@ -0,0 +1,43 @@
+// Package admindto defines the bodies of the /admin endpoints.
+package admindto
+
+import (
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+type SessionDTO struct {
+	ID              string    `json:"id"`
+	GameID          string    `json:"game_id"`
+	GameDisplayName string    `json:"game_display_name"`
+	Codec           string    `json:"codec"`
+	FrameRate       float32   `json:"frame_rate"`
+	State           string    `json:"state"`
+	TargetBitrate   int       `json:"target_bitrate"`
+	StartedAt       time.Time `json:"started_at"`
+	// Uptime is in seconds
+	Uptime float64 `json:"uptime"`
+}
+
+type SessionStatsDTO struct {
+	SessionDTO
+	ICEState    string  `json:"ice_state"`
+	NACKBitrate float64 `json:"nack_bitrate"`
+	// Estimator is the state of the congestion controller, empty until the
+	// peer connection is connected
+	Estimator map[string]interface{} `json:"estimator"`
+	WebRTC    webrtc.StatsReport     `json:"webrtc"`
+}
+
+type CapabilitiesDTO struct {
+	ProtocolVersions []int `json:"protocol_versions"`
+	// Codecs are the codecs whose encoder is available in FFmpeg
+	Codecs   []string `json:"codecs"`
+	WHEP     bool     `json:"whep"`
+	TURN     bool     `json:"turn"`
+	TLS      bool     `json:"tls"`
+	Auth     bool     `json:"auth"`
+	Pairing  bool     `json:"pairing"`
+	Sessions int      `json:"sessions"`
+}
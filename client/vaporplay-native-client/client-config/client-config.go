@@ -2,9 +2,13 @@ package clientconfig
 
 import (
 	"bufio"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"net/http"
 	"os"
 
 	"github.com/3DRX/vaporplay/config"
@@ -13,6 +17,14 @@ import (
 type ClientConfig struct {
 	SessionConfig config.SessionConfig `json:"session_config"`
 	Addr          string               `json:"addr"`
+	ICEConfig     config.ICEConfig     `json:"ice"`
+	// Token is sent as a bearer token when the server requires auth
+	Token string `json:"token,omitempty"`
+	// Key is the client key stored by -pair, used when Token is empty
+	Key string `json:"key,omitempty"`
+	// TLSFingerprint pins the SHA-256 fingerprint of the server certificate
+	// for an https addr, for self-signed certificates
+	TLSFingerprint string `json:"tls_fingerprint,omitempty"`
 }
 
 // load client config from configPath
@@ -39,6 +51,10 @@ func LoadClientConfig(configPath *string) (*ClientConfig, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = config.CheckICEConfig(&cfg.ICEConfig)
+	if err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
 
@@ -75,3 +91,45 @@ func SaveClientConfig(configPath string, cfg *ClientConfig) error {
 	}
 	return nil
 }
+
+// AuthHeader returns the headers that authenticate requests to the server.
+func (c *ClientConfig) AuthHeader() http.Header {
+	header := http.Header{}
+	if c.Token != "" {
+		header.Set("Authorization", "Bearer "+c.Token)
+	} else if c.Key != "" {
+		header.Set("Authorization", "Bearer "+c.Key)
+	}
+	return header
+}
+
+// TLSConfig verifies the server certificate against TLSFingerprint if it's
+// set, and against the system roots otherwise.
+func (c *ClientConfig) TLSConfig() *tls.Config {
+	if c.TLSFingerprint == "" {
+		return &tls.Config{}
+	}
+	return &tls.Config{
+		// the fingerprint check below replaces the chain verification
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("server sent no certificate")
+			}
+			fingerprint := config.CertFingerprint(rawCerts[0])
+			if !config.FingerprintsEqual(fingerprint, c.TLSFingerprint) {
+				return fmt.Errorf("server certificate fingerprint %s doesn't match the pinned one", fingerprint)
+			}
+			return nil
+		},
+	}
+}
+
+// HTTPClient returns a client for requests to the server.
+func (c *ClientConfig) HTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = c.TLSConfig()
+	return &http.Client{
+		Transport: transport,
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"image"
 
+	clientconfig "github.com/3DRX/vaporplay/client/vaporplay-native-client/client-config"
 	"github.com/3DRX/vaporplay/client/vaporplay-native-client/peerconnection"
 	"github.com/3DRX/vaporplay/client/vaporplay-native-client/signaling"
 	"github.com/3DRX/vaporplay/client/vaporplay-native-client/ui"
@@ -13,15 +14,31 @@ import (
 // TODO: add profile capability to native client
 // var cpuProfile = flag.String("cpuprofile", "", "write cpu profile to file")
 var configPath = flag.String("config", "client_config.json", "path to config file")
+var pair = flag.Bool("pair", false, "pair with the server in the config file and exit")
 
 func main() {
 	flag.Parse()
 	if *configPath == "" {
 		panic("config file path is required")
 	}
+	if *pair {
+		cfg, err := clientconfig.LoadClientConfig(configPath)
+		if err != nil {
+			panic(err)
+		}
+		if err := signaling.Pair(cfg); err != nil {
+			panic(err)
+		}
+		if err := clientconfig.SaveClientConfig(*configPath, cfg); err != nil {
+			panic(err)
+		}
+		return
+	}
 	sdpChan := make(chan webrtc.SessionDescription)
 	sdpReplyChan := make(chan webrtc.SessionDescription)
 	candidateChan := make(chan webrtc.ICECandidateInit)
+	candidateReplyChan := make(chan webrtc.ICECandidateInit)
+	iceServersChan := make(chan []webrtc.ICEServer)
 	frameChan := make(chan image.Image, 120)
 	closeWindowPromise := make(chan struct{}, 1)
 
@@ -34,6 +51,8 @@ func main() {
 		sdpChan,
 		sdpReplyChan,
 		candidateChan,
+		candidateReplyChan,
+		iceServersChan,
 	)
 	go func() {
 		clientCfg := <-startGamePromise
@@ -43,6 +62,8 @@ func main() {
 			sdpChan,
 			sdpReplyChan,
 			candidateChan,
+			candidateReplyChan,
+			iceServersChan,
 			frameChan,
 			closeWindowPromise,
 		)
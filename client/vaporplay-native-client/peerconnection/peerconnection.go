@@ -22,6 +22,12 @@ type PeerConnectionThread struct {
 	sdpChan            <-chan webrtc.SessionDescription
 	sdpReplyChan       chan<- webrtc.SessionDescription
 	candidateChan      <-chan webrtc.ICECandidateInit
+	candidateReplyChan chan<- webrtc.ICECandidateInit
+	iceServersChan     <-chan []webrtc.ICEServer
+	api                *webrtc.API
+	configuration      webrtc.Configuration
+	// peerConnection is created on the first offer, once the ICE servers
+	// advertised by the server are known
 	peerConnection     *webrtc.PeerConnection
 	frameChan          chan<- image.Image
 	closeWindowPromise <-chan struct{}
@@ -32,12 +38,15 @@ func NewPeerConnectionThread(
 	sdpChan chan webrtc.SessionDescription,
 	sdpReplyChan chan<- webrtc.SessionDescription,
 	candidateChan <-chan webrtc.ICECandidateInit,
+	candidateReplyChan chan<- webrtc.ICECandidateInit,
+	iceServersChan <-chan []webrtc.ICEServer,
 	frameChan chan<- image.Image,
 	closeWindowPromise <-chan struct{},
 ) *PeerConnectionThread {
 	m := &webrtc.MediaEngine{}
 	i := &interceptor.Registry{}
 	s := webrtc.SettingEngine{}
+	clientConfig.ICEConfig.ConfigureSettingEngine(&s)
 
 	if err := configureCodec(m, clientConfig.SessionConfig.CodecConfig); err != nil {
 		panic(err)
@@ -58,34 +67,43 @@ func NewPeerConnectionThread(
 		webrtc.WithSettingEngine(s),
 	)
 	config := webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{
-				URLs: []string{"stun:stun.l.google.com:19302"},
-			},
-		},
+		ICEServers: clientConfig.ICEConfig.ICEServers(),
 		// FIXME: pion's SetRemoteDescription will treat SDP as PlanB if it contains FEC track
 		// For now, we remove FEC in SDP. In the future, we need to add FEC back.
 	}
-	peerConnection, err := api.NewPeerConnection(config)
-	if err != nil {
-		panic(err)
-	}
-	slog.Info("Created peer connection")
 	return &PeerConnectionThread{
 		clientConfig:       clientConfig,
 		sdpChan:            sdpChan,
 		sdpReplyChan:       sdpReplyChan,
 		candidateChan:      candidateChan,
-		peerConnection:     peerConnection,
+		candidateReplyChan: candidateReplyChan,
+		iceServersChan:     iceServersChan,
+		api:                api,
+		configuration:      config,
+		peerConnection:     nil,
 		frameChan:          frameChan,
 		closeWindowPromise: closeWindowPromise,
 	}
 }
 
-func handleSignalingMessage(pc *PeerConnectionThread) {
+func handleSignalingMessage(pc *PeerConnectionThread, videoDecoder *VideoDecoder) {
 	for {
 		select {
+		case iceServers := <-pc.iceServersChan:
+			if pc.peerConnection != nil {
+				slog.Warn("ICE servers advertised after the offer, ignoring")
+				continue
+			}
+			if pc.clientConfig.ICEConfig.HostOnly {
+				slog.Info("host only mode, ignoring advertised ICE servers")
+				continue
+			}
+			pc.configuration.ICEServers = append(pc.configuration.ICEServers, iceServers...)
 		case sdp := <-pc.sdpChan:
+			if pc.peerConnection == nil {
+				pc.createPeerConnection(videoDecoder)
+			}
+			// offers after the first one restart ICE
 			err := pc.peerConnection.SetRemoteDescription(sdp)
 			if err != nil {
 				panic(err)
@@ -94,16 +112,32 @@ func handleSignalingMessage(pc *PeerConnectionThread) {
 			if err != nil {
 				panic(err)
 			}
+			// hand the answer over before gathering starts in
+			// SetLocalDescription, so that none of our candidates overtakes it
+			pc.sdpReplyChan <- answer
 			err = pc.peerConnection.SetLocalDescription(answer)
 			if err != nil {
 				panic(err)
 			}
-			pc.sdpReplyChan <- answer
 		case candidate := <-pc.candidateChan:
+			if pc.peerConnection == nil {
+				slog.Warn("ICE candidate before offer, ignoring", "candidate", candidate.Candidate)
+				continue
+			}
 			err := pc.peerConnection.AddICECandidate(candidate)
+			if err != nil {
+				slog.Warn("failed to add ICE candidate", "candidate", candidate.Candidate, "error", err)
+			}
+		case <-pc.closeWindowPromise:
+			if pc.peerConnection == nil {
+				return
+			}
+			err := pc.peerConnection.GracefulClose()
+			// FIXME: this can't close properly
 			if err != nil {
 				panic(err)
 			}
+			return
 		}
 	}
 }
@@ -111,6 +145,16 @@ func handleSignalingMessage(pc *PeerConnectionThread) {
 func (pc *PeerConnectionThread) Spin() {
 	videoDecoder := newVideoDecoder(pc.clientConfig.SessionConfig.CodecConfig, pc.frameChan)
 	videoDecoder.Init()
+	handleSignalingMessage(pc, videoDecoder)
+}
+
+func (pc *PeerConnectionThread) createPeerConnection(videoDecoder *VideoDecoder) {
+	peerConnection, err := pc.api.NewPeerConnection(pc.configuration)
+	if err != nil {
+		panic(err)
+	}
+	slog.Info("Created peer connection")
+	pc.peerConnection = peerConnection
 	pc.peerConnection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
 		slog.Info("OnConnectionStateChange", "state", state.String())
 	})
@@ -120,6 +164,14 @@ func (pc *PeerConnectionThread) Spin() {
 	pc.peerConnection.OnICEGatheringStateChange(func(state webrtc.ICEGatheringState) {
 		slog.Info("OnICEGatheringStateChange", "state", state.String())
 	})
+	pc.peerConnection.OnICECandidate(func(c *webrtc.ICECandidate) {
+		// an empty candidate tells the server that gathering is complete
+		candidate := webrtc.ICECandidateInit{}
+		if c != nil {
+			candidate = c.ToJSON()
+		}
+		pc.candidateReplyChan <- candidate
+	})
 	pc.peerConnection.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
 		slog.Info("PeerConnectionChannel: OnTrack", "track", track.ID())
 		if track.Kind() == webrtc.RTPCodecTypeVideo {
@@ -155,17 +207,6 @@ func (pc *PeerConnectionThread) Spin() {
 			d.SendText(string(dtoString))
 		}
 	})
-
-	go func() {
-		<-pc.closeWindowPromise
-		err := pc.peerConnection.GracefulClose()
-		// FIXME: this can't close properly
-		if err != nil {
-			panic(err)
-		}
-	}()
-
-	handleSignalingMessage(pc)
 }
 
 func configureCodec(m *webrtc.MediaEngine, config config.CodecConfig) error {
@@ -0,0 +1,57 @@
+package signaling
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	clientconfig "github.com/3DRX/vaporplay/client/vaporplay-native-client/client-config"
+	"github.com/3DRX/vaporplay/signalingdto"
+)
+
+// Pair asks the server to pair this client and blocks until the operator
+// enters the printed PIN on the server. On success the client key is
+// stored in cfg.
+func Pair(cfg *clientconfig.ClientConfig) error {
+	b := make([]byte, 34)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	key := hex.EncodeToString(b[:32])
+	pin := fmt.Sprintf("%04d", (int(b[32])<<8|int(b[33]))%10000)
+	name, err := os.Hostname()
+	if err != nil {
+		name = "vaporplay-native-client"
+	}
+	body, err := json.Marshal(signalingdto.PairRequestDTO{
+		Name: name,
+		Key:  key,
+		PIN:  pin,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Enter PIN %s on the server to pair %s\n", pin, name)
+	resp, err := cfg.HTTPClient().Post(cfg.Addr+"/pair", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("pairing failed: %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	paired := signalingdto.PairResponseDTO{}
+	if err := json.NewDecoder(resp.Body).Decode(&paired); err != nil {
+		return err
+	}
+	fmt.Printf("Paired as %s\n", paired.ClientID)
+	cfg.Key = key
+	return nil
+}
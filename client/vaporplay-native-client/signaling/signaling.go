@@ -6,27 +6,36 @@ import (
 	"net/url"
 
 	clientconfig "github.com/3DRX/vaporplay/client/vaporplay-native-client/client-config"
+	"github.com/3DRX/vaporplay/signalingdto"
 	"github.com/gorilla/websocket"
 	"github.com/pion/webrtc/v4"
 )
 
 type SignalingThread struct {
-	c             *websocket.Conn
-	sdpChan       chan<- webrtc.SessionDescription
-	sdpReplyChan  <-chan webrtc.SessionDescription
-	candidateChan chan<- webrtc.ICECandidateInit
+	c                  *websocket.Conn
+	version            int
+	sdpChan            chan<- webrtc.SessionDescription
+	sdpReplyChan       <-chan webrtc.SessionDescription
+	candidateChan      chan<- webrtc.ICECandidateInit
+	candidateReplyChan <-chan webrtc.ICECandidateInit
+	iceServersChan     chan<- []webrtc.ICEServer
 }
 
 func NewSignalingThread(
 	sdpChan chan webrtc.SessionDescription,
 	sdpReplyChan <-chan webrtc.SessionDescription,
 	candidateChan chan<- webrtc.ICECandidateInit,
+	candidateReplyChan <-chan webrtc.ICECandidateInit,
+	iceServersChan chan<- []webrtc.ICEServer,
 ) *SignalingThread {
 	return &SignalingThread{
-		c:             nil,
-		sdpChan:       sdpChan,
-		sdpReplyChan:  sdpReplyChan,
-		candidateChan: candidateChan,
+		c:                  nil,
+		version:            signalingdto.LegacyProtocolVersion,
+		sdpChan:            sdpChan,
+		sdpReplyChan:       sdpReplyChan,
+		candidateChan:      candidateChan,
+		candidateReplyChan: candidateReplyChan,
+		iceServersChan:     iceServersChan,
 	}
 }
 
@@ -35,15 +44,27 @@ func (s *SignalingThread) Spin(cfg *clientconfig.ClientConfig) {
 	if err != nil {
 		panic(err)
 	}
-	u.Scheme = "ws"
+	if u.Scheme == "https" {
+		u.Scheme = "wss"
+	} else {
+		u.Scheme = "ws"
+	}
 	u.Path = "/webrtc"
 	slog.Info("start spinning", "url", u.String())
-	wsConn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = signalingdto.Subprotocols()
+	dialer.TLSClientConfig = cfg.TLSConfig()
+	wsConn, _, err := dialer.Dial(u.String(), cfg.AuthHeader())
 	if err != nil {
 		panic(err)
 	}
 	s.c = wsConn
 	defer wsConn.Close()
+	s.version, err = signalingdto.ParseSubprotocol(wsConn.Subprotocol())
+	if err != nil {
+		panic(err)
+	}
+	slog.Info("negotiated protocol version", "version", s.version)
 	go func() {
 		for {
 			_, message, err := wsConn.ReadMessage()
@@ -55,25 +76,115 @@ func (s *SignalingThread) Spin(cfg *clientconfig.ClientConfig) {
 		}
 	}()
 
-	cfgMessage, err := json.Marshal(cfg.SessionConfig)
-	if err != nil {
-		slog.Error("compose session config error", "error", err)
+	if err := s.send(signalingdto.TypeSessionRequest, cfg.SessionConfig); err != nil {
+		slog.Error("send session config error", "error", err)
 		return
 	}
-	wsConn.WriteMessage(websocket.TextMessage, cfgMessage)
 	slog.Info("send configure message")
-	answer := <-s.sdpReplyChan // await answer from peer connection
-	payload, err := json.Marshal(answer)
-	if err != nil {
-		slog.Error("marshal error", "error", err)
+	for {
+		select {
+		case answer := <-s.sdpReplyChan:
+			if err := s.send(signalingdto.TypeAnswer, answer); err != nil {
+				slog.Error("send answer error", "error", err)
+			}
+			slog.Info("send answer", "sdp", answer.SDP)
+		case candidate := <-s.candidateReplyChan:
+			if err := s.send(signalingdto.TypeCandidate, candidate); err != nil {
+				slog.Error("send candidate error", "error", err)
+			}
+			slog.Info("send ICE candidate", "candidate", candidate.Candidate)
+		}
 	}
-	wsConn.WriteMessage(websocket.TextMessage, payload)
-	slog.Info("send answer", "sdp", answer.SDP)
+}
 
-	select {}
+// send writes payload to the server, wrapped in an envelope of type t unless
+// the server only speaks the legacy protocol.
+func (s *SignalingThread) send(t signalingdto.MessageType, payload interface{}) error {
+	var v interface{} = payload
+	if s.version != signalingdto.LegacyProtocolVersion {
+		msg, err := signalingdto.NewMessage(t, payload)
+		if err != nil {
+			return err
+		}
+		v = msg
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.c.WriteMessage(websocket.TextMessage, b)
 }
 
 func (s *SignalingThread) onWsMessage(messageRaw []byte) {
+	if s.version == signalingdto.LegacyProtocolVersion {
+		s.onLegacyWsMessage(messageRaw)
+		return
+	}
+	msg := signalingdto.Message{}
+	if err := json.Unmarshal(messageRaw, &msg); err != nil {
+		slog.Warn("malformed message", "message", string(messageRaw), "error", err)
+		return
+	}
+	switch msg.Type {
+	case signalingdto.TypeOffer:
+		sdp := webrtc.SessionDescription{}
+		if err := msg.Decode(&sdp); err != nil {
+			slog.Warn("malformed offer", "error", err)
+			return
+		}
+		s.sdpChan <- sdp
+		slog.Info("received SDP", "sdp", sdp)
+	case signalingdto.TypeCandidate:
+		candidate := webrtc.ICECandidateInit{}
+		if err := msg.Decode(&candidate); err != nil {
+			slog.Warn("malformed candidate", "error", err)
+			return
+		}
+		s.candidateChan <- candidate
+		slog.Info("received ICE candidate", "candidate", candidate)
+	case signalingdto.TypeICEServers:
+		servers := signalingdto.ICEServersDTO{}
+		if err := msg.Decode(&servers); err != nil {
+			slog.Warn("malformed ice servers", "error", err)
+			return
+		}
+		iceServers := make([]webrtc.ICEServer, 0, len(servers.Servers))
+		for _, server := range servers.Servers {
+			iceServers = append(iceServers, webrtc.ICEServer{
+				URLs:       server.URLs,
+				Username:   server.Username,
+				Credential: server.Credential,
+			})
+		}
+		s.iceServersChan <- iceServers
+		slog.Info("received ICE servers", "count", len(iceServers))
+	case signalingdto.TypeError:
+		e := signalingdto.ErrorDTO{}
+		if err := msg.Decode(&e); err != nil {
+			slog.Warn("malformed error", "error", err)
+			return
+		}
+		slog.Error("server reported error", "code", e.Code, "message", e.Message)
+	case signalingdto.TypeBye:
+		bye := signalingdto.ByeDTO{}
+		if err := msg.Decode(&bye); err != nil {
+			slog.Warn("malformed bye", "error", err)
+			return
+		}
+		slog.Info("server said bye", "reason", bye.Reason)
+	case signalingdto.TypeStats:
+		stats := signalingdto.StatsDTO{}
+		if err := msg.Decode(&stats); err != nil {
+			slog.Warn("malformed stats", "error", err)
+			return
+		}
+		slog.Debug("received stats", "stats", stats)
+	default:
+		slog.Warn("unknown message type", "type", msg.Type)
+	}
+}
+
+func (s *SignalingThread) onLegacyWsMessage(messageRaw []byte) {
 	// see if this is webrtc.SessionDescription or webrtc.ICECandidateInit
 	sdp := webrtc.SessionDescription{}
 	candidate := webrtc.ICECandidateInit{}
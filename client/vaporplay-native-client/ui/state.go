@@ -65,7 +65,12 @@ func fetchGameData(configPath string) (*[]config.GameConfig, error) {
 	}
 	url := fmt.Sprintf("%s/%s", cfg.Addr, "games")
 	slog.Info("fetchGameData", "url", url)
-	resp, err := http.Get(url)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = cfg.AuthHeader()
+	resp, err := cfg.HTTPClient().Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"encoding/hex"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultLoginSessionTTL is how long a web UI login lasts, in seconds.
+const DefaultLoginSessionTTL = 7 * 24 * 60 * 60
+
+type UserConfig struct {
+	Username string `json:"username"`
+	// PasswordHash is a bcrypt hash, see the -hash-password flag
+	PasswordHash string `json:"password_hash"`
+}
+
+// AuthConfig configures who may list and launch games. Authentication is
+// disabled when neither tokens, users nor pairing are configured.
+type AuthConfig struct {
+	// TokenHashes are hex encoded SHA-256 digests of the accepted bearer
+	// tokens, see the -new-token flag
+	TokenHashes []string     `json:"token_hashes,omitempty"`
+	Users       []UserConfig `json:"users,omitempty"`
+	// Pairing lets clients pair with a PIN approved by the operator, paired
+	// clients are kept in paired_clients.json next to the config file
+	Pairing bool `json:"pairing,omitempty"`
+	// SessionTTL is the lifetime of a web UI login in seconds
+	SessionTTL int `json:"session_ttl,omitempty"`
+}
+
+func (c *AuthConfig) Enabled() bool {
+	return len(c.TokenHashes) != 0 || len(c.Users) != 0 || c.Pairing
+}
+
+func (v *validator) checkAuth(path string, c *AuthConfig) {
+	for i, tokenHash := range c.TokenHashes {
+		b, err := hex.DecodeString(tokenHash)
+		if err != nil || len(b) != 32 {
+			v.addf(index(join(path, "token_hashes"), i), "not a hex encoded sha256 digest")
+		}
+	}
+	usernames := map[string]bool{}
+	for i, user := range c.Users {
+		userPath := index(join(path, "users"), i)
+		if user.Username == "" {
+			v.addf(join(userPath, "username"), "must not be empty")
+		} else if usernames[user.Username] {
+			v.addf(join(userPath, "username"), "duplicate user \"%s\"", user.Username)
+		}
+		usernames[user.Username] = true
+		if _, err := bcrypt.Cost([]byte(user.PasswordHash)); err != nil {
+			v.addf(join(userPath, "password_hash"), "not a bcrypt hash")
+		}
+	}
+	if c.SessionTTL < 0 {
+		v.addf(join(path, "session_ttl"), "must not be negative")
+	}
+}
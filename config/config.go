@@ -1,11 +1,10 @@
 package config
 
 import (
-	"bufio"
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net"
 	"os"
@@ -34,14 +33,106 @@ type GameConfig struct {
 	GameWindowName  string                     `json:"game_window_name"`
 	GameDisplayName string                     `json:"game_display_name"`
 	GameIcon        string                     `json:"game_icon"`
+	InstallDir      string                     `json:"install_dir,omitempty"`
 	EndGameCommands []KillProcessCommandConfig `json:"end_game_commands"`
+	// CaptureSource names the gamecapture source frames come from,
+	// DefaultCaptureSource when empty
+	CaptureSource string `json:"capture_source,omitempty"`
+	// CaptureMode is what the x11 source captures, DefaultCaptureMode when
+	// empty
+	CaptureMode string `json:"capture_mode,omitempty"`
+	// CaptureMonitor is the XRandR monitor of the monitor mode, like
+	// "DP-1", the primary monitor when empty
+	CaptureMonitor string `json:"capture_monitor,omitempty"`
+	// CaptureRect limits the capture to a part of the window, screen or
+	// monitor, in its coordinates
+	CaptureRect *CaptureRect       `json:"capture_rect,omitempty"`
+	WindowMatch *WindowMatchConfig `json:"window_match,omitempty"` // for the window capture mode
+	TestPattern *TestPatternConfig `json:"test_pattern,omitempty"` // for the testpattern source
+	MediaFile   *MediaFileConfig   `json:"media_file,omitempty"`   // for the mediafile source
 }
 
+// WindowMatchConfig picks the game window. Every criterion that is set must
+// match, when none is set the window title or class has to contain
+// game_window_name.
+type WindowMatchConfig struct {
+	// PID matches windows whose _NET_WM_PID is in the process tree Steam
+	// launched the game in
+	PID bool `json:"pid,omitempty"`
+	// Class is the WM_CLASS name or class of the window
+	Class string `json:"class,omitempty"`
+	// Title is a regular expression the window title must match
+	Title string `json:"title,omitempty"`
+	// MinWidth and MinHeight skip smaller windows like splash screens,
+	// zero values pick the defaults
+	MinWidth  int `json:"min_width,omitempty"`
+	MinHeight int `json:"min_height,omitempty"`
+	// Timeout is how long to wait for the window in seconds, and for it to
+	// come back when it is destroyed, zero picks the default
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// HasCriteria reports whether c picks windows by something else than
+// game_window_name, c may be nil.
+func (c *WindowMatchConfig) HasCriteria() bool {
+	return c != nil && (c.PID || c.Class != "" || c.Title != "")
+}
+
+// CaptureRect is a rectangle in pixels.
+type CaptureRect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// TestPatternConfig sets up the synthetic frames of the testpattern capture
+// source, zero values pick the defaults.
+type TestPatternConfig struct {
+	Width     int     `json:"width,omitempty"`
+	Height    int     `json:"height,omitempty"`
+	FrameRate float32 `json:"frame_rate,omitempty"`
+}
+
+// MediaFileConfig sets up the mediafile capture source, which plays the
+// video stream of a local file at its own frame rate.
+type MediaFileConfig struct {
+	Path string `json:"path"`
+	// Loop starts the file over when it ends, otherwise the last frame is held
+	Loop bool `json:"loop,omitempty"`
+	// Seek is where playback starts, and starts over when looping, in
+	// seconds from the start of the file
+	Seek float64 `json:"seek,omitempty"`
+}
+
+// SteamImportConfig adds the games of the local Steam library to Games on
+// startup.
+type SteamImportConfig struct {
+	Enabled bool `json:"enabled"`
+	// Root is the Steam installation, the one in the home directory is used
+	// when empty
+	Root string `json:"root,omitempty"`
+}
+
+// DefaultShutdownTimeout is how long running sessions get to clean up when
+// the server is stopped, in seconds.
+const DefaultShutdownTimeout = 10
+
 type Config struct {
-	Addr                string       `json:"addr"` // http service address
-	EphemeralUDPPortMin uint16       `json:"ephemeral_udp_port_min"`
-	EphemeralUDPPortMax uint16       `json:"ephemeral_udp_port_max"`
-	Games               []GameConfig `json:"games"`
+	Addr                string            `json:"addr"`                   // http service address
+	ListenAddrs         []string          `json:"listen_addrs,omitempty"` // more addresses to serve on, e.g. "[::]:8080"
+	DevicePath          string            `json:"device_path"`            // render device of the hardware encoders
+	DefaultCodec        CodecConfig       `json:"default_codec"`          // for clients that don't pick a codec
+	EphemeralUDPPortMin uint16            `json:"ephemeral_udp_port_min"`
+	EphemeralUDPPortMax uint16            `json:"ephemeral_udp_port_max"`
+	ICE                 ICEConfig         `json:"ice"`
+	TURN                TURNConfig        `json:"turn"`
+	Auth                AuthConfig        `json:"auth"`
+	TLS                 TLSConfig         `json:"tls"`
+	SteamImport         SteamImportConfig `json:"steam_import"`
+	AllowedOrigins      []string          `json:"allowed_origins"`  // browser origins besides our own, "*" allows any
+	ShutdownTimeout     int               `json:"shutdown_timeout"` // seconds to end sessions on SIGINT/SIGTERM
+	Games               []GameConfig      `json:"games"`
 }
 
 func isValidAddr(addr *string) bool {
@@ -52,11 +143,14 @@ func isValidAddr(addr *string) bool {
 		host = *addr
 	}
 
-	// First try to parse as IP address
-	ip := net.ParseIP(host)
-	if ip != nil {
-		// If it's a valid IP, check if it's IPv4
-		return ip.To4() != nil
+	// An empty host listens on all IPv4 and IPv6 addresses
+	if host == "" {
+		return true
+	}
+
+	// First try to parse as IPv4 or IPv6 address
+	if net.ParseIP(host) != nil {
+		return true
 	}
 
 	// Check if it's a valid hostname
@@ -66,18 +160,7 @@ func isValidAddr(addr *string) bool {
 
 	// If not a valid hostname, try to resolve it
 	ips, err := net.LookupIP(host)
-	if err != nil || len(ips) == 0 {
-		return false
-	}
-
-	// Check if any of the resolved IPs is IPv4
-	for _, ip := range ips {
-		if ip.To4() != nil {
-			return true
-		}
-	}
-
-	return false
+	return err == nil && len(ips) != 0
 }
 
 func isValidHostname(host string) bool {
@@ -113,53 +196,87 @@ func isValidHostname(host string) bool {
 	return true
 }
 
-func checkCfg(c *Config) error {
-	if !isValidAddr(&c.Addr) {
-		return fmt.Errorf("invalid ipv4 addr \"%s\"", c.Addr)
-	}
-	// TODO: check game configs
-	return nil
+// ListenAddresses returns every address the http service listens on.
+func (c *Config) ListenAddresses() []string {
+	return append([]string{c.Addr}, c.ListenAddrs...)
 }
 
-func LoadCfg(cfgPath string) *Config {
-	if _, err := os.Stat(cfgPath); errors.Is(err, os.ErrNotExist) {
-		slog.Info(cfgPath + " not found, using default config")
-		return &Config{
-			Addr: "localhost:8080",
-		}
-	}
-	f, err := os.Open(cfgPath)
-	if err != nil {
-		panic(err)
-	}
-	defer f.Close()
-	stat, err := f.Stat()
-	if err != nil {
-		panic(err)
-	}
-	bf := make([]byte, stat.Size())
-	_, err = bufio.NewReader(f).Read(bf)
-	if err != nil && err != io.EOF {
-		panic(err)
+// decodeError turns a JSON decoding error into a validation error that
+// points at the offending value.
+func decodeError(b []byte, err error) error {
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxError):
+		line := 1 + bytes.Count(b[:syntaxError.Offset], []byte("\n"))
+		column := syntaxError.Offset - int64(bytes.LastIndexByte(b[:syntaxError.Offset], '\n'))
+		return &ValidationError{Errors: []*FieldError{{
+			Message: fmt.Sprintf("line %d, column %d: %s", line, column-1, syntaxError.Error()),
+		}}}
+	case errors.As(err, &typeError):
+		return &ValidationError{Errors: []*FieldError{{
+			Path:    typeError.Field,
+			Message: fmt.Sprintf("must be %s, not %s", typeError.Type.String(), typeError.Value),
+		}}}
 	}
+	return err
+}
+
+// ParseCfg decodes a config, applies the environment and overrides on top,
+// fills in defaults and validates it. cfgPath is where the config is
+// stored. Invalid configs return a *ValidationError.
+func ParseCfg(b []byte, cfgPath string, overrides Overrides) (*Config, error) {
 	c := &Config{}
-	err = json.Unmarshal(bf, c)
-	if err != nil {
-		panic(err)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, decodeError(b, err)
 	}
-	err = checkCfg(c)
-	if err != nil {
-		panic(err)
+	v := &validator{}
+	v.applyOverrides(c, overrides)
+	if err := v.err(); err != nil {
+		return nil, err
 	}
-
 	if c.EphemeralUDPPortMin == 0 {
 		c.EphemeralUDPPortMin = 1
 	}
 	if c.EphemeralUDPPortMax == 0 {
 		c.EphemeralUDPPortMax = 65535
 	}
+	if c.TURN.CredentialTTL == 0 {
+		c.TURN.CredentialTTL = DefaultTURNCredentialTTL
+	}
+	if c.Auth.SessionTTL == 0 {
+		c.Auth.SessionTTL = DefaultLoginSessionTTL
+	}
+	if c.DevicePath == "" {
+		c.DevicePath = DefaultDevicePath
+	}
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	fillCodecConfig(&c.DefaultCodec)
+	fillTLSConfig(&c.TLS, cfgPath)
+	if err := CheckCfg(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadCfg loads the config file at cfgPath, values from VAPORPLAY_*
+// environment variables and then overrides take precedence over the file.
+func LoadCfg(cfgPath string, overrides Overrides) (*Config, error) {
+	b, err := os.ReadFile(cfgPath)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info(cfgPath + " not found, using default config")
+		b = []byte(`{"addr": "localhost:8080"}`)
+	} else if err != nil {
+		return nil, err
+	}
+	c, err := ParseCfg(b, cfgPath, overrides)
+	if err != nil {
+		return nil, err
+	}
 
 	// Print config
-	slog.Info("config loaded", "config", c)
-	return c
+	slog.Info("config loaded", "config", c.Redacted())
+	return c, nil
 }
@@ -0,0 +1,290 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"unicode"
+)
+
+var (
+	ErrGameExists  = errors.New("game already exists")
+	ErrUnknownGame = errors.New("no such game")
+	ErrInvalidGame = errors.New("invalid game")
+)
+
+// clone copies the game config, so that later changes to the catalog don't
+// reach sessions that already started with it.
+func (g GameConfig) clone() GameConfig {
+	commands := make([]KillProcessCommandConfig, len(g.EndGameCommands))
+	for i, command := range g.EndGameCommands {
+		commands[i] = KillProcessCommandConfig{
+			Flags:       append([]string(nil), command.Flags...),
+			ProcessName: command.ProcessName,
+		}
+	}
+	g.EndGameCommands = commands
+	if g.CaptureRect != nil {
+		rect := *g.CaptureRect
+		g.CaptureRect = &rect
+	}
+	if g.WindowMatch != nil {
+		windowMatch := *g.WindowMatch
+		g.WindowMatch = &windowMatch
+	}
+	if g.TestPattern != nil {
+		testPattern := *g.TestPattern
+		g.TestPattern = &testPattern
+	}
+	if g.MediaFile != nil {
+		mediaFile := *g.MediaFile
+		g.MediaFile = &mediaFile
+	}
+	return g
+}
+
+// GameCatalog holds the games of the config and writes every change back to
+// the config file.
+type GameCatalog struct {
+	cfgPath string
+	games   []GameConfig
+	lock    sync.RWMutex
+}
+
+func NewGameCatalog(cfgPath string, games []GameConfig) *GameCatalog {
+	c := &GameCatalog{
+		cfgPath: cfgPath,
+		games:   make([]GameConfig, 0, len(games)),
+	}
+	for _, g := range games {
+		c.games = append(c.games, g.clone())
+	}
+	return c
+}
+
+// Replace sets the games without writing them to the config file, for a
+// config that was reloaded from it.
+func (c *GameCatalog) Replace(games []GameConfig) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.games = make([]GameConfig, 0, len(games))
+	for _, g := range games {
+		c.games = append(c.games, g.clone())
+	}
+}
+
+// List returns a copy of all games.
+func (c *GameCatalog) List() []GameConfig {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	games := make([]GameConfig, 0, len(c.games))
+	for _, g := range c.games {
+		games = append(games, g.clone())
+	}
+	return games
+}
+
+// Get returns a copy of a game.
+func (c *GameCatalog) Get(id string) (GameConfig, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for _, g := range c.games {
+		if g.GameId == id {
+			return g.clone(), true
+		}
+	}
+	return GameConfig{}, false
+}
+
+func (c *GameCatalog) index(id string) int {
+	for i, g := range c.games {
+		if g.GameId == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Add adds a new game.
+func (c *GameCatalog) Add(g GameConfig) error {
+	if err := CheckGameConfig(&g); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidGame, err)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.index(g.GameId) != -1 {
+		return ErrGameExists
+	}
+	games := append(append([]GameConfig(nil), c.games...), g.clone())
+	return c.save(games)
+}
+
+// Update replaces the game with id, g may change the id.
+func (c *GameCatalog) Update(id string, g GameConfig) error {
+	if err := CheckGameConfig(&g); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidGame, err)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	i := c.index(id)
+	if i == -1 {
+		return ErrUnknownGame
+	}
+	if g.GameId != id && c.index(g.GameId) != -1 {
+		return ErrGameExists
+	}
+	games := append([]GameConfig(nil), c.games...)
+	games[i] = g.clone()
+	return c.save(games)
+}
+
+// Remove removes the game with id.
+func (c *GameCatalog) Remove(id string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	i := c.index(id)
+	if i == -1 {
+		return ErrUnknownGame
+	}
+	games := append([]GameConfig(nil), c.games[:i]...)
+	games = append(games, c.games[i+1:]...)
+	return c.save(games)
+}
+
+// save writes games into the config file, leaving the other fields as they
+// are, and makes them the current games once the file is written.
+func (c *GameCatalog) save(games []GameConfig) error {
+	b, err := os.ReadFile(c.cfgPath)
+	if errors.Is(err, os.ErrNotExist) {
+		b, err = []byte("{}"), nil
+	}
+	if err != nil {
+		return err
+	}
+	b, err = spliceGames(b, games)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(c.cfgPath, b); err != nil {
+		return err
+	}
+	c.games = games
+	return nil
+}
+
+// spliceGames replaces the value of the top level "games" field of the JSON
+// object in b, or adds the field at the end. The rest of b keeps its bytes,
+// the games are indented like the fields of the object.
+func spliceGames(b []byte, games []GameConfig) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if t != json.Delim('{') {
+		return nil, errors.New("config file is not a JSON object")
+	}
+	fields := 0
+	indent := ""
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		end := int(dec.InputOffset())
+		start := end - len(value)
+		if fields == 0 {
+			indent = lineIndent(b, start)
+		}
+		fields++
+		if t != "games" {
+			continue
+		}
+		encoded, err := marshalGames(games, lineIndent(b, start))
+		if err != nil {
+			return nil, err
+		}
+		return slices.Concat(b[:start], encoded, b[end:]), nil
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	closing := int(dec.InputOffset()) - 1
+	if fields == 0 {
+		indent = "    "
+	}
+	encoded, err := marshalGames(games, indent)
+	if err != nil {
+		return nil, err
+	}
+	// after the last field, or after the opening brace
+	last := bytes.LastIndexFunc(b[:closing], func(r rune) bool {
+		return !unicode.IsSpace(r)
+	}) + 1
+	field := []byte("\n" + indent + `"games": `)
+	if fields != 0 && indent == "" {
+		// a compact file stays on one line
+		field = []byte(`"games":`)
+	}
+	if fields != 0 {
+		field = append([]byte(","), field...)
+	}
+	tail := b[last:]
+	if fields == 0 {
+		tail = append([]byte("\n"), b[closing:]...)
+	}
+	return slices.Concat(b[:last], field, encoded, tail), nil
+}
+
+// lineIndent returns the whitespace the line of b at offset starts with.
+func lineIndent(b []byte, offset int) string {
+	lineStart := bytes.LastIndexByte(b[:offset], '\n') + 1
+	line := b[lineStart:offset]
+	return string(line[:len(line)-len(bytes.TrimLeft(line, " \t"))])
+}
+
+func marshalGames(games []GameConfig, indent string) ([]byte, error) {
+	if indent == "" {
+		return json.Marshal(games)
+	}
+	return json.MarshalIndent(games, indent, indent)
+}
+
+// writeFileAtomic replaces the file at path, readers see either the old or
+// the new content.
+func writeFileAtomic(path string, b []byte) error {
+	mode := os.FileMode(0644)
+	if stat, err := os.Stat(path); err == nil {
+		mode = stat.Mode().Perm()
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
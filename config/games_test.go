@@ -0,0 +1,133 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// the fields around games are out of order and oddly formatted on purpose
+const catalogConfig = `{
+  "addr": "0.0.0.0:8080",
+  "ephemeral_udp_port_max": 10500,
+  "ephemeral_udp_port_min": 10000,
+  "games": [
+    {
+      "game_id": "383870",
+      "game_window_name": "Firewatch",
+      "game_display_name": "Fire Watch",
+      "game_icon": "",
+      "end_game_commands": []
+    }
+  ],
+  "allowed_origins": [ "https://example.com" ],
+  "default_codec": {"codec": "libx264"}
+}
+`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func readGames(t *testing.T, b []byte) []GameConfig {
+	t.Helper()
+	c := struct {
+		Games []GameConfig `json:"games"`
+	}{}
+	if err := json.Unmarshal(b, &c); err != nil {
+		t.Fatalf("config file is not valid JSON: %v\n%s", err, b)
+	}
+	return c.Games
+}
+
+var terraria = GameConfig{
+	GameId:          "105600",
+	GameWindowName:  "Terraria",
+	GameDisplayName: "Terraria",
+	EndGameCommands: []KillProcessCommandConfig{},
+}
+
+func TestGameCatalogKeepsOtherFields(t *testing.T) {
+	p := writeConfig(t, catalogConfig)
+	var games []GameConfig
+	if err := json.Unmarshal([]byte(catalogConfig), &struct {
+		Games *[]GameConfig `json:"games"`
+	}{&games}); err != nil {
+		t.Fatal(err)
+	}
+	c := NewGameCatalog(p, games)
+	if err := c.Add(terraria); err != nil {
+		t.Fatal(err)
+	}
+	start := bytes.Index([]byte(catalogConfig), []byte(`"games": `)) + len(`"games": `)
+	end := bytes.Index([]byte(catalogConfig), []byte(`,
+  "allowed_origins"`))
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b, []byte(catalogConfig[:start])) || !bytes.HasSuffix(b, []byte(catalogConfig[end:])) {
+		t.Errorf("fields besides games changed:\n%s", b)
+	}
+	if got := readGames(t, b); len(got) != 2 || got[1].GameId != terraria.GameId {
+		t.Errorf("got games %+v after adding %s", got, terraria.GameId)
+	}
+
+	// removing the game again gives back the original games
+	if err := c.Remove(terraria.GameId); err != nil {
+		t.Fatal(err)
+	}
+	b, err = os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != catalogConfig {
+		t.Errorf("got config\n%s\nwant\n%s", b, catalogConfig)
+	}
+}
+
+func TestGameCatalogAddsGamesField(t *testing.T) {
+	for _, content := range []string{
+		"{\n    \"addr\": \"0.0.0.0:8080\"\n}\n",
+		`{"addr":"0.0.0.0:8080"}`,
+		"{}",
+	} {
+		p := writeConfig(t, content)
+		c := NewGameCatalog(p, nil)
+		if err := c.Add(terraria); err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := readGames(t, b); len(got) != 1 || got[0].GameId != terraria.GameId {
+			t.Errorf("got games %+v from %q", got, content)
+		}
+		if bytes.Contains([]byte(content), []byte("addr")) && !bytes.Contains(b, []byte(`"addr"`)) {
+			t.Errorf("addr is gone from %q:\n%s", content, b)
+		}
+	}
+}
+
+func TestGameCatalogCreatesFile(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "config.json")
+	c := NewGameCatalog(p, nil)
+	if err := c.Add(terraria); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readGames(t, b); len(got) != 1 {
+		t.Errorf("got games %+v", got)
+	}
+}
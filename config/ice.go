@@ -0,0 +1,178 @@
+package config
+
+import (
+	"net"
+	"strings"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// DefaultICEServerURL is used when no ICE server is configured.
+const DefaultICEServerURL = "stun:stun.l.google.com:19302"
+
+type ICEServerConfig struct {
+	URLs []string `json:"urls"`
+	// Username and Credential are required for turn: and turns: urls
+	Username   string `json:"username,omitempty"`
+	Credential string `json:"credential,omitempty"`
+}
+
+type ICEConfig struct {
+	// Servers defaults to DefaultICEServerURL when empty
+	Servers []ICEServerConfig `json:"servers,omitempty"`
+	// HostOnly gathers host candidates only and never contacts a STUN or
+	// TURN server, for isolated LANs
+	HostOnly bool `json:"host_only,omitempty"`
+	// NAT1To1IPs are the public IPs of a 1:1 NAT in front of this host
+	NAT1To1IPs []string `json:"nat_1to1_ips,omitempty"`
+	// NAT1To1CandidateType is "host" (the default) to replace host candidate
+	// IPs with NAT1To1IPs, or "srflx" to add them as server reflexive
+	// candidates
+	NAT1To1CandidateType string `json:"nat_1to1_candidate_type,omitempty"`
+	// Interfaces restricts gathering to the named network interfaces,
+	// all interfaces are used when empty
+	Interfaces []string `json:"interfaces,omitempty"`
+	// ExcludedInterfaces are never used for gathering
+	ExcludedInterfaces []string `json:"excluded_interfaces,omitempty"`
+	// IPv6 set to false gathers IPv4 candidates only, pion's default
+	// network types are used when it is unset
+	IPv6 *bool `json:"ipv6,omitempty"`
+}
+
+func CheckICEConfig(c *ICEConfig) error {
+	v := &validator{}
+	v.checkICE("ice", c)
+	return v.err()
+}
+
+func (v *validator) checkICE(path string, c *ICEConfig) {
+	if c.HostOnly && len(c.Servers) != 0 {
+		v.addf(join(path, "servers"), "ice servers can't be used in host only mode")
+	}
+	for i, server := range c.Servers {
+		serverPath := index(join(path, "servers"), i)
+		if len(server.URLs) == 0 {
+			v.addf(join(serverPath, "urls"), "must not be empty")
+		}
+		for j, u := range server.URLs {
+			scheme, _, _ := strings.Cut(u, ":")
+			switch scheme {
+			case "stun", "stuns":
+			case "turn", "turns":
+				if server.Username == "" || server.Credential == "" {
+					v.addf(serverPath, "turn server \"%s\" requires username and credential", u)
+				}
+			default:
+				v.addf(index(join(serverPath, "urls"), j), "invalid ice server url \"%s\"", u)
+			}
+		}
+	}
+	for i, ip := range c.NAT1To1IPs {
+		if net.ParseIP(ip) == nil {
+			v.addf(index(join(path, "nat_1to1_ips"), i), "invalid ip \"%s\"", ip)
+		}
+	}
+	switch c.NAT1To1CandidateType {
+	case "", "host", "srflx":
+	default:
+		v.addf(join(path, "nat_1to1_candidate_type"), "must be \"host\" or \"srflx\"")
+	}
+}
+
+// ICEServers returns the ICE servers for a webrtc.Configuration.
+func (c *ICEConfig) ICEServers() []webrtc.ICEServer {
+	if c.HostOnly {
+		return []webrtc.ICEServer{}
+	}
+	if len(c.Servers) == 0 {
+		return []webrtc.ICEServer{
+			{
+				URLs: []string{DefaultICEServerURL},
+			},
+		}
+	}
+	servers := make([]webrtc.ICEServer, 0, len(c.Servers))
+	for _, server := range c.Servers {
+		servers = append(servers, webrtc.ICEServer{
+			URLs:       server.URLs,
+			Username:   server.Username,
+			Credential: server.Credential,
+		})
+	}
+	return servers
+}
+
+// ConfigureSettingEngine applies NAT 1:1 mapping, interface filters and
+// the network types to gather candidates for.
+func (c *ICEConfig) ConfigureSettingEngine(s *webrtc.SettingEngine) {
+	if c.IPv6 != nil {
+		networkTypes := []webrtc.NetworkType{webrtc.NetworkTypeUDP4}
+		if *c.IPv6 {
+			networkTypes = append(networkTypes, webrtc.NetworkTypeUDP6)
+		}
+		s.SetNetworkTypes(networkTypes)
+	}
+	if len(c.NAT1To1IPs) != 0 {
+		candidateType := webrtc.ICECandidateTypeHost
+		if c.NAT1To1CandidateType == "srflx" {
+			candidateType = webrtc.ICECandidateTypeSrflx
+		}
+		s.SetNAT1To1IPs(c.NAT1To1IPs, candidateType)
+	}
+	if len(c.Interfaces) != 0 || len(c.ExcludedInterfaces) != 0 {
+		s.SetInterfaceFilter(func(name string) bool {
+			for _, excluded := range c.ExcludedInterfaces {
+				if name == excluded {
+					return false
+				}
+			}
+			if len(c.Interfaces) == 0 {
+				return true
+			}
+			for _, included := range c.Interfaces {
+				if name == included {
+					return true
+				}
+			}
+			return false
+		})
+	}
+}
+
+// DefaultTURNCredentialTTL is how long TURN credentials handed to a session
+// stay valid, in seconds.
+const DefaultTURNCredentialTTL = 12 * 60 * 60
+
+// TURNConfig configures the TURN server embedded in the server.
+type TURNConfig struct {
+	Enabled bool `json:"enabled"`
+	// Port is the UDP listen port, it must be within the ephemeral UDP
+	// port range, which is also used for relayed addresses
+	Port uint16 `json:"port"`
+	// PublicIP is the address clients reach the server at
+	PublicIP string `json:"public_ip"`
+	// CredentialTTL is in seconds, credentials are also revoked when their
+	// session ends
+	CredentialTTL int `json:"credential_ttl,omitempty"`
+}
+
+func (v *validator) checkTURN(path string, c *Config) {
+	if !c.TURN.Enabled {
+		return
+	}
+	if c.TURN.Port < c.EphemeralUDPPortMin || c.TURN.Port > c.EphemeralUDPPortMax {
+		v.addf(
+			join(path, "port"),
+			"%d is not within the ephemeral udp port range %d-%d",
+			c.TURN.Port,
+			c.EphemeralUDPPortMin,
+			c.EphemeralUDPPortMax,
+		)
+	}
+	if net.ParseIP(c.TURN.PublicIP) == nil {
+		v.addf(join(path, "public_ip"), "invalid ip \"%s\"", c.TURN.PublicIP)
+	}
+	if c.TURN.CredentialTTL < 0 {
+		v.addf(join(path, "credential_ttl"), "must not be negative")
+	}
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix starts the environment variables that override config values.
+const EnvPrefix = "VAPORPLAY_"
+
+// Overrides maps config paths like "default_codec.codec" to values. It is
+// a flag.Value for repeated -set path=value flags.
+type Overrides map[string]string
+
+func (o Overrides) String() string {
+	paths := make([]string, 0, len(o))
+	for path, value := range o {
+		paths = append(paths, path+"="+value)
+	}
+	sort.Strings(paths)
+	return strings.Join(paths, ",")
+}
+
+func (o Overrides) Set(s string) error {
+	path, value, ok := strings.Cut(s, "=")
+	if !ok || path == "" {
+		return fmt.Errorf("expected path=value, got %q", s)
+	}
+	o[path] = value
+	return nil
+}
+
+// envName returns the environment variable that overrides a config path.
+func envName(path string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+// options returns the config values that can be overridden, by path. Those
+// are scalars and lists of strings, lists of objects like games can only be
+// set in the file.
+func options(c *Config) map[string]reflect.Value {
+	opts := map[string]reflect.Value{}
+	var walk func(prefix string, v reflect.Value)
+	walk = func(prefix string, v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "" || name == "-" {
+				continue
+			}
+			path := join(prefix, name)
+			switch field.Type.Kind() {
+			case reflect.Struct:
+				walk(path, v.Field(i))
+			case reflect.Slice:
+				if field.Type.Elem().Kind() == reflect.String {
+					opts[path] = v.Field(i)
+				}
+			default:
+				opts[path] = v.Field(i)
+			}
+		}
+	}
+	walk("", reflect.ValueOf(c).Elem())
+	return opts
+}
+
+func setOption(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("must be true or false")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be an unsigned integer of %d bits", v.Type().Bits())
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		// comma separated, an empty value clears the list
+		values := []string{}
+		if s != "" {
+			values = strings.Split(s, ",")
+		}
+		v.Set(reflect.ValueOf(values))
+	case reflect.Pointer:
+		// optional values, an empty value unsets it
+		if s == "" {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		p := reflect.New(v.Type().Elem())
+		if err := setOption(p.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(p)
+	default:
+		return fmt.Errorf("can't be overridden")
+	}
+	return nil
+}
+
+// applyOverrides sets config values from VAPORPLAY_* environment variables,
+// then from overrides, so that flags take precedence over the environment
+// and both over the file.
+func (v *validator) applyOverrides(c *Config, overrides Overrides) {
+	opts := options(c)
+	envPaths := map[string]string{}
+	for path := range opts {
+		envPaths[envName(path)] = path
+	}
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+		path, ok := envPaths[name]
+		if !ok {
+			slog.Warn("ignoring unknown config environment variable", "name", name)
+			continue
+		}
+		if err := setOption(opts[path], value); err != nil {
+			v.addf(path, "%s from %s", err, name)
+		}
+	}
+	paths := make([]string, 0, len(overrides))
+	for path := range overrides {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		opt, ok := opts[path]
+		if !ok {
+			v.addf(path, "unknown config path in -set")
+			continue
+		}
+		if err := setOption(opt, overrides[path]); err != nil {
+			v.addf(path, "%s from -set", err)
+		}
+	}
+}
+
+const redacted = "<redacted>"
+
+// Redacted returns a copy of the config with credentials replaced, for
+// printing and logging.
+func (c *Config) Redacted() *Config {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return &Config{}
+	}
+	r := &Config{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return &Config{}
+	}
+	for i := range r.ICE.Servers {
+		if r.ICE.Servers[i].Credential != "" {
+			r.ICE.Servers[i].Credential = redacted
+		}
+	}
+	for i := range r.Auth.TokenHashes {
+		r.Auth.TokenHashes[i] = redacted
+	}
+	for i := range r.Auth.Users {
+		r.Auth.Users[i].PasswordHash = redacted
+	}
+	return r
+}
@@ -0,0 +1,207 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const layersConfig = `{
+	"addr": "localhost:8080",
+	"shutdown_timeout": 5,
+	"default_codec": {"codec": "libx264", "frame_rate": 30},
+	"ice": {"host_only": false}
+}`
+
+func TestOverridePrecedence(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		overrides Overrides
+		codec     string
+		frameRate float32
+	}{
+		{
+			name:      "file",
+			codec:     "libx264",
+			frameRate: 30,
+		},
+		{
+			name:      "environment over file",
+			env:       map[string]string{"VAPORPLAY_DEFAULT_CODEC_CODEC": "h264_nvenc"},
+			codec:     "h264_nvenc",
+			frameRate: 30,
+		},
+		{
+			name:      "flag over file",
+			overrides: Overrides{"default_codec.frame_rate": "90"},
+			codec:     "libx264",
+			frameRate: 90,
+		},
+		{
+			name: "flag over environment",
+			env: map[string]string{
+				"VAPORPLAY_DEFAULT_CODEC_CODEC":      "h264_nvenc",
+				"VAPORPLAY_DEFAULT_CODEC_FRAME_RATE": "120",
+			},
+			overrides: Overrides{"default_codec.codec": "av1_nvenc"},
+			codec:     "av1_nvenc",
+			frameRate: 120,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			c, err := ParseCfg([]byte(layersConfig), "config.json", test.overrides)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.DefaultCodec.Codec != test.codec || c.DefaultCodec.FrameRate != test.frameRate {
+				t.Errorf("got codec %s at %v fps, want %s at %v fps", c.DefaultCodec.Codec, c.DefaultCodec.FrameRate, test.codec, test.frameRate)
+			}
+		})
+	}
+}
+
+func TestOverrideTypes(t *testing.T) {
+	t.Setenv("VAPORPLAY_ICE_HOST_ONLY", "true")
+	t.Setenv("VAPORPLAY_ALLOWED_ORIGINS", "https://a.example,https://b.example")
+	c, err := ParseCfg([]byte(layersConfig), "config.json", Overrides{
+		"shutdown_timeout":       "30",
+		"ephemeral_udp_port_min": "20000",
+		"ephemeral_udp_port_max": "20100",
+		"ice.ipv6":               "false",
+		"ice.interfaces":         "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.ICE.HostOnly {
+		t.Error("ice.host_only is not set")
+	}
+	if want := []string{"https://a.example", "https://b.example"}; !reflect.DeepEqual(c.AllowedOrigins, want) {
+		t.Errorf("got allowed_origins %q, want %q", c.AllowedOrigins, want)
+	}
+	if c.ShutdownTimeout != 30 {
+		t.Errorf("got shutdown_timeout %d, want 30", c.ShutdownTimeout)
+	}
+	if c.EphemeralUDPPortMin != 20000 || c.EphemeralUDPPortMax != 20100 {
+		t.Errorf("got ephemeral udp ports %d-%d, want 20000-20100", c.EphemeralUDPPortMin, c.EphemeralUDPPortMax)
+	}
+	if c.ICE.IPv6 == nil || *c.ICE.IPv6 {
+		t.Errorf("got ice.ipv6 %v, want false", c.ICE.IPv6)
+	}
+	if c.ICE.Interfaces == nil || len(c.ICE.Interfaces) != 0 {
+		t.Errorf("got ice.interfaces %q, want an empty list", c.ICE.Interfaces)
+	}
+}
+
+func TestOverrideErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		overrides Overrides
+		path      string
+		message   string
+	}{
+		{
+			name:      "not an integer",
+			overrides: Overrides{"shutdown_timeout": "soon"},
+			path:      "shutdown_timeout",
+			message:   "from -set",
+		},
+		{
+			name:    "port out of range",
+			env:     map[string]string{"VAPORPLAY_EPHEMERAL_UDP_PORT_MAX": "70000"},
+			path:    "ephemeral_udp_port_max",
+			message: "from VAPORPLAY_EPHEMERAL_UDP_PORT_MAX",
+		},
+		{
+			name:      "not a bool",
+			overrides: Overrides{"tls.enabled": "maybe"},
+			path:      "tls.enabled",
+			message:   "must be true or false",
+		},
+		{
+			name:      "unknown path",
+			overrides: Overrides{"default_codec.bitrate": "1"},
+			path:      "default_codec.bitrate",
+			message:   "unknown config path",
+		},
+		{
+			name:      "games can't be overridden",
+			overrides: Overrides{"games": "[]"},
+			path:      "games",
+			message:   "unknown config path",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			_, err := ParseCfg([]byte(layersConfig), "config.json", test.overrides)
+			paths := errorPaths(t, err)
+			if !reflect.DeepEqual(paths, []string{test.path}) || !strings.Contains(err.Error(), test.message) {
+				t.Errorf("got %v, want an error at %s containing %q", err, test.path, test.message)
+			}
+		})
+	}
+}
+
+func TestOverridesSet(t *testing.T) {
+	o := Overrides{}
+	if err := o.Set("default_codec.codec=libx264"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Set("allowed_origins=https://a.example,https://b.example"); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"default_codec.codec", "=libx264"} {
+		if err := o.Set(s); err == nil {
+			t.Errorf("Set(%q) succeeded", s)
+		}
+	}
+	want := "allowed_origins=https://a.example,https://b.example,default_codec.codec=libx264"
+	if o.String() != want {
+		t.Errorf("got %q, want %q", o.String(), want)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	c := &Config{
+		Addr: "localhost:8080",
+		ICE: ICEConfig{
+			Servers: []ICEServerConfig{
+				{URLs: []string{"stun:stun.example.com"}},
+				{URLs: []string{"turn:turn.example.com"}, Username: "user", Credential: "secret"},
+			},
+		},
+		Auth: AuthConfig{
+			TokenHashes: []string{"0123", "4567"},
+			Users:       []UserConfig{{Username: "admin", PasswordHash: "$2a$10$hash"}},
+		},
+	}
+	r := c.Redacted()
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret", "0123", "4567", "$2a$10$hash"} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("redacted config contains %q: %s", secret, b)
+		}
+	}
+	if r.ICE.Servers[0].Credential != "" || r.ICE.Servers[1].Credential != redacted {
+		t.Errorf("got credentials %q and %q", r.ICE.Servers[0].Credential, r.ICE.Servers[1].Credential)
+	}
+	if r.ICE.Servers[1].Username != "user" || r.Auth.Users[0].Username != "admin" {
+		t.Error("redacted config lost usernames")
+	}
+	if c.ICE.Servers[1].Credential != "secret" || c.Auth.TokenHashes[0] != "0123" || c.Auth.Users[0].PasswordHash != "$2a$10$hash" {
+		t.Error("Redacted changed the original config")
+	}
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// watchInterval is how often the config file is checked for changes.
+const watchInterval = 2 * time.Second
+
+// Reloader holds the current config and replaces it with a new one from the
+// config file on SIGHUP or when the file changes. Readers get the config
+// with Config, which is swapped atomically, so anything that should keep
+// its settings (like a running session) holds on to the *Config it got.
+type Reloader struct {
+	cfgPath   string
+	overrides Overrides
+	current   atomic.Pointer[Config]
+	lock      sync.Mutex
+	listeners []func(cfg *Config)
+}
+
+func NewReloader(cfgPath string, overrides Overrides, cfg *Config) *Reloader {
+	r := &Reloader{
+		cfgPath:   cfgPath,
+		overrides: overrides,
+	}
+	r.current.Store(cfg)
+	return r
+}
+
+// Config returns the current config, it must not be modified.
+func (r *Reloader) Config() *Config {
+	return r.current.Load()
+}
+
+// OnReload registers f to be called with every new config.
+func (r *Reloader) OnReload(f func(cfg *Config)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.listeners = append(r.listeners, f)
+}
+
+// Reload reads and validates the config file, and swaps it in if it is
+// valid. The current config stays in place otherwise.
+func (r *Reloader) Reload() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	b, err := os.ReadFile(r.cfgPath)
+	if err != nil {
+		return err
+	}
+	cfg, err := ParseCfg(b, r.cfgPath, r.overrides)
+	if err != nil {
+		return err
+	}
+	old := r.current.Swap(cfg)
+	for _, path := range restartRequired(old, cfg) {
+		slog.Warn("config change needs a restart to take effect", "path", path)
+	}
+	for _, f := range r.listeners {
+		f(cfg)
+	}
+	slog.Info("config reloaded", "config", cfg.Redacted())
+	return nil
+}
+
+// restartRequired returns the changed settings that only apply on startup.
+func restartRequired(old *Config, cfg *Config) []string {
+	paths := []string{}
+	if old.Addr != cfg.Addr || !reflect.DeepEqual(old.ListenAddrs, cfg.ListenAddrs) {
+		paths = append(paths, "addr")
+	}
+	if !reflect.DeepEqual(old.TLS, cfg.TLS) {
+		paths = append(paths, "tls")
+	}
+	if !reflect.DeepEqual(old.TURN, cfg.TURN) {
+		paths = append(paths, "turn")
+	}
+	if !reflect.DeepEqual(old.SteamImport, cfg.SteamImport) {
+		paths = append(paths, "steam_import")
+	}
+	return paths
+}
+
+func (r *Reloader) reload(reason string) {
+	slog.Info("reloading config", "path", r.cfgPath, "reason", reason)
+	if err := r.Reload(); err != nil {
+		slog.Error("config reload rejected, keeping the current config", "error", err)
+	}
+}
+
+// Watch reloads the config on SIGHUP and when the file changes, until stop
+// is closed.
+func (r *Reloader) Watch(stop <-chan struct{}) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	content, _ := os.ReadFile(r.cfgPath)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hup:
+			content, _ = os.ReadFile(r.cfgPath)
+			r.reload("SIGHUP")
+		case <-ticker.C:
+			b, err := os.ReadFile(r.cfgPath)
+			if err != nil || bytes.Equal(b, content) {
+				continue
+			}
+			content = b
+			r.reload("file changed")
+		}
+	}
+}
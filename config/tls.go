@@ -0,0 +1,64 @@
+package config
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// TLSConfig enables HTTPS and WSS. Either CertFile and KeyFile point to an
+// existing certificate, or SelfSigned generates one on first run and keeps
+// it at CertFile and KeyFile, which default to files next to config.json.
+type TLSConfig struct {
+	Enabled    bool   `json:"enabled"`
+	CertFile   string `json:"cert_file,omitempty"`
+	KeyFile    string `json:"key_file,omitempty"`
+	SelfSigned bool   `json:"self_signed,omitempty"`
+	// Hosts are extra DNS names and IPs put into a self-signed certificate,
+	// besides localhost, the hostname and the addresses of this machine
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+func fillTLSConfig(c *TLSConfig, cfgPath string) {
+	if !c.Enabled || !c.SelfSigned {
+		return
+	}
+	if c.CertFile == "" {
+		c.CertFile = filepath.Join(filepath.Dir(cfgPath), "vaporplay_cert.pem")
+	}
+	if c.KeyFile == "" {
+		c.KeyFile = filepath.Join(filepath.Dir(cfgPath), "vaporplay_key.pem")
+	}
+}
+
+func (v *validator) checkTLS(path string, c *TLSConfig) {
+	if !c.Enabled {
+		return
+	}
+	if c.CertFile == "" {
+		v.addf(join(path, "cert_file"), "required unless self_signed is set")
+	}
+	if c.KeyFile == "" {
+		v.addf(join(path, "key_file"), "required unless self_signed is set")
+	}
+}
+
+// CertFingerprint returns the SHA-256 fingerprint of a DER encoded
+// certificate in the colon separated hex format openssl prints.
+func CertFingerprint(der []byte) string {
+	digest := sha256.Sum256(der)
+	parts := make([]string, len(digest))
+	for i, b := range digest {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// FingerprintsEqual compares fingerprints regardless of case and colons.
+func FingerprintsEqual(a string, b string) bool {
+	normalize := func(s string) string {
+		return strings.ToUpper(strings.ReplaceAll(s, ":", ""))
+	}
+	return normalize(a) == normalize(b)
+}
@@ -0,0 +1,348 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Codecs are the codec names a CodecConfig may use.
+var Codecs = []string{"av1_nvenc", "hevc_nvenc", "h264_nvenc", "libx264"}
+
+// CaptureSources are the capture sources a GameConfig may use.
+var CaptureSources = []string{"x11", "testpattern", "mediafile"}
+
+// DefaultCaptureSource captures the game window with X11.
+const DefaultCaptureSource = "x11"
+
+// CaptureModes are the capture modes of the x11 capture source: the game
+// window, the whole screen or one monitor.
+var CaptureModes = []string{"window", "screen", "monitor"}
+
+// DefaultCaptureMode captures the game window.
+const DefaultCaptureMode = "window"
+
+// Defaults of a WindowMatchConfig, the timeout is in seconds. Smaller
+// windows are usually the loading windows of games.
+const (
+	DefaultWindowMinWidth  = 0
+	DefaultWindowMinHeight = 720
+	DefaultWindowTimeout   = 120
+)
+
+// Bounds of a CodecConfig, bitrates are in bits per second.
+const (
+	MinFrameRate = 1
+	MaxFrameRate = 240
+	MinBitrate   = 1_000_000
+	MaxBitrate   = 200_000_000
+)
+
+// Defaults of the codec config and encoder device.
+const (
+	DefaultDevicePath     = "/dev/dri/card1"
+	DefaultCodec          = "h264_nvenc"
+	DefaultFrameRate      = 60
+	DefaultInitialBitrate = 5_000_000
+	DefaultMaxBitrate     = 30_000_000
+)
+
+func fillCodecConfig(c *CodecConfig) {
+	c.FillFrom(CodecConfig{
+		Codec:          DefaultCodec,
+		FrameRate:      DefaultFrameRate,
+		InitialBitrate: DefaultInitialBitrate,
+		MaxBitrate:     DefaultMaxBitrate,
+	})
+}
+
+// FillFrom sets the fields of c that are left out to those of defaults.
+func (c *CodecConfig) FillFrom(defaults CodecConfig) {
+	if c.Codec == "" {
+		c.Codec = defaults.Codec
+	}
+	if c.FrameRate == 0 {
+		c.FrameRate = defaults.FrameRate
+	}
+	if c.InitialBitrate == 0 {
+		c.InitialBitrate = defaults.InitialBitrate
+	}
+	if c.MaxBitrate == 0 {
+		c.MaxBitrate = defaults.MaxBitrate
+	}
+}
+
+// FieldError is a problem with the value at Path, a JSON path into the
+// validated document like "games[2].game_id".
+type FieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e *FieldError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError lists every problem found in a document.
+type ValidationError struct {
+	Errors []*FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// validator collects field errors instead of stopping at the first one.
+type validator struct {
+	errors []*FieldError
+}
+
+func (v *validator) addf(path string, format string, args ...interface{}) {
+	v.errors = append(v.errors, &FieldError{
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// err returns a *ValidationError, or nil if there are no errors.
+func (v *validator) err() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errors}
+}
+
+// join appends a field to a path.
+func join(path string, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+func index(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+func (v *validator) checkGame(path string, g *GameConfig) {
+	if g.GameId == "" {
+		v.addf(join(path, "game_id"), "must not be empty")
+	}
+	source := g.CaptureSource
+	if source == "" {
+		source = DefaultCaptureSource
+	}
+	known := false
+	for _, s := range CaptureSources {
+		if source == s {
+			known = true
+		}
+	}
+	if !known {
+		v.addf(join(path, "capture_source"), "unknown capture source %q, must be one of %s", source, strings.Join(CaptureSources, ", "))
+	}
+	mode := g.CaptureMode
+	if mode == "" {
+		mode = DefaultCaptureMode
+	}
+	if source == "x11" {
+		v.checkCaptureMode(path, g, mode)
+	} else if g.CaptureMode != "" || g.CaptureMonitor != "" || g.CaptureRect != nil || g.WindowMatch != nil {
+		v.addf(join(path, "capture_mode"), "only the x11 capture source has capture modes")
+	}
+	if g.TestPattern != nil {
+		v.checkTestPattern(join(path, "test_pattern"), g.TestPattern)
+	}
+	if source == "mediafile" && g.MediaFile == nil {
+		v.addf(join(path, "media_file"), "must be set for the mediafile capture source")
+	}
+	if g.MediaFile != nil {
+		v.checkMediaFile(join(path, "media_file"), g.MediaFile)
+	}
+	if g.GameDisplayName == "" {
+		v.addf(join(path, "game_display_name"), "must not be empty")
+	}
+	for i, command := range g.EndGameCommands {
+		if command.ProcessName == "" {
+			v.addf(join(index(join(path, "end_game_commands"), i), "process_name"), "must not be empty")
+		}
+	}
+}
+
+func (v *validator) checkCaptureMode(path string, g *GameConfig, mode string) {
+	known := false
+	for _, m := range CaptureModes {
+		if mode == m {
+			known = true
+		}
+	}
+	if !known {
+		v.addf(join(path, "capture_mode"), "unknown capture mode %q, must be one of %s", mode, strings.Join(CaptureModes, ", "))
+	}
+	if mode == "window" && g.GameWindowName == "" && !g.WindowMatch.HasCriteria() {
+		v.addf(join(path, "game_window_name"), "must not be empty")
+	}
+	if g.WindowMatch != nil {
+		if mode != "window" {
+			v.addf(join(path, "window_match"), "only used by the window capture mode")
+		}
+		v.checkWindowMatch(join(path, "window_match"), g.WindowMatch)
+	}
+	if mode != "monitor" && g.CaptureMonitor != "" {
+		v.addf(join(path, "capture_monitor"), "only used by the monitor capture mode")
+	}
+	if r := g.CaptureRect; r != nil {
+		rectPath := join(path, "capture_rect")
+		if r.X < 0 {
+			v.addf(join(rectPath, "x"), "must not be negative")
+		}
+		if r.Y < 0 {
+			v.addf(join(rectPath, "y"), "must not be negative")
+		}
+		if r.Width <= 0 {
+			v.addf(join(rectPath, "width"), "must be positive")
+		}
+		if r.Height <= 0 {
+			v.addf(join(rectPath, "height"), "must be positive")
+		}
+	}
+}
+
+func (v *validator) checkWindowMatch(path string, c *WindowMatchConfig) {
+	if c.Title != "" {
+		if _, err := regexp.Compile(c.Title); err != nil {
+			v.addf(join(path, "title"), "invalid regular expression: %s", err)
+		}
+	}
+	if c.MinWidth < 0 {
+		v.addf(join(path, "min_width"), "must not be negative")
+	}
+	if c.MinHeight < 0 {
+		v.addf(join(path, "min_height"), "must not be negative")
+	}
+	if c.Timeout < 0 {
+		v.addf(join(path, "timeout"), "must not be negative")
+	}
+}
+
+// Bounds of a TestPatternConfig, the frame id barcode needs the width.
+const (
+	MinTestPatternWidth  = 160
+	MinTestPatternHeight = 90
+	MaxTestPatternSize   = 7680
+)
+
+func (v *validator) checkTestPattern(path string, c *TestPatternConfig) {
+	// encoders only take even sizes
+	if c.Width != 0 && (c.Width < MinTestPatternWidth || c.Width > MaxTestPatternSize || c.Width%2 != 0) {
+		v.addf(join(path, "width"), "must be an even number between %d and %d", MinTestPatternWidth, MaxTestPatternSize)
+	}
+	if c.Height != 0 && (c.Height < MinTestPatternHeight || c.Height > MaxTestPatternSize || c.Height%2 != 0) {
+		v.addf(join(path, "height"), "must be an even number between %d and %d", MinTestPatternHeight, MaxTestPatternSize)
+	}
+	if c.FrameRate != 0 && (c.FrameRate < MinFrameRate || c.FrameRate > MaxFrameRate) {
+		v.addf(join(path, "frame_rate"), "must be between %d and %d", MinFrameRate, MaxFrameRate)
+	}
+}
+
+func (v *validator) checkMediaFile(path string, c *MediaFileConfig) {
+	if c.Path == "" {
+		v.addf(join(path, "path"), "must not be empty")
+	}
+	if c.Seek < 0 {
+		v.addf(join(path, "seek"), "must not be negative")
+	}
+}
+
+func (v *validator) checkGames(path string, games []GameConfig) {
+	ids := map[string]int{}
+	for i := range games {
+		gamePath := index(path, i)
+		v.checkGame(gamePath, &games[i])
+		if games[i].GameId == "" {
+			continue
+		}
+		if first, ok := ids[games[i].GameId]; ok {
+			v.addf(join(gamePath, "game_id"), "duplicate of %s", join(index(path, first), "game_id"))
+			continue
+		}
+		ids[games[i].GameId] = i
+	}
+}
+
+func (v *validator) checkCodec(path string, c *CodecConfig) {
+	known := false
+	for _, codec := range Codecs {
+		if c.Codec == codec {
+			known = true
+		}
+	}
+	if !known {
+		v.addf(join(path, "codec"), "unknown codec %q, must be one of %s", c.Codec, strings.Join(Codecs, ", "))
+	}
+	if c.FrameRate < MinFrameRate || c.FrameRate > MaxFrameRate {
+		v.addf(join(path, "frame_rate"), "must be between %d and %d", MinFrameRate, MaxFrameRate)
+	}
+	if c.InitialBitrate < MinBitrate || c.InitialBitrate > MaxBitrate {
+		v.addf(join(path, "initial_bitrate"), "must be between %d and %d", MinBitrate, MaxBitrate)
+	}
+	if c.MaxBitrate < MinBitrate || c.MaxBitrate > MaxBitrate {
+		v.addf(join(path, "max_bitrate"), "must be between %d and %d", MinBitrate, MaxBitrate)
+	} else if c.InitialBitrate > c.MaxBitrate {
+		v.addf(join(path, "initial_bitrate"), "must not be greater than max_bitrate")
+	}
+}
+
+// CheckGameConfig validates a single game config.
+func CheckGameConfig(g *GameConfig) error {
+	v := &validator{}
+	v.checkGame("", g)
+	return v.err()
+}
+
+// CheckSessionConfig validates the session config a client asks for.
+func CheckSessionConfig(c *SessionConfig) error {
+	v := &validator{}
+	v.checkGame("game_config", &c.GameConfig)
+	v.checkCodec("codec_config", &c.CodecConfig)
+	return v.err()
+}
+
+// CheckCfg validates a config whose defaults are filled in.
+func CheckCfg(c *Config) error {
+	v := &validator{}
+	if !isValidAddr(&c.Addr) {
+		v.addf("addr", "invalid address %q", c.Addr)
+	}
+	for i := range c.ListenAddrs {
+		if !isValidAddr(&c.ListenAddrs[i]) {
+			v.addf(index("listen_addrs", i), "invalid address %q", c.ListenAddrs[i])
+		}
+	}
+	if c.EphemeralUDPPortMin == 0 {
+		v.addf("ephemeral_udp_port_min", "must not be 0")
+	}
+	if c.EphemeralUDPPortMin > c.EphemeralUDPPortMax {
+		v.addf("ephemeral_udp_port_min", "must not be greater than ephemeral_udp_port_max")
+	}
+	if c.DevicePath == "" {
+		v.addf("device_path", "must not be empty")
+	}
+	if c.ShutdownTimeout < 0 {
+		v.addf("shutdown_timeout", "must not be negative")
+	}
+	v.checkCodec("default_codec", &c.DefaultCodec)
+	v.checkICE("ice", &c.ICE)
+	v.checkTURN("turn", c)
+	v.checkAuth("auth", &c.Auth)
+	v.checkTLS("tls", &c.TLS)
+	v.checkGames("games", c.Games)
+	return v.err()
+}
@@ -0,0 +1,230 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// errorPaths returns the paths of the field errors of a *ValidationError.
+func errorPaths(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var validationError *ValidationError
+	if !errors.As(err, &validationError) {
+		t.Fatalf("got %T %v, want a *ValidationError", err, err)
+	}
+	paths := []string{}
+	for _, e := range validationError.Errors {
+		paths = append(paths, e.Path)
+	}
+	return paths
+}
+
+func TestParseCfgErrorPaths(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   string
+		paths []string
+	}{
+		{
+			name: "valid",
+			cfg: `{"addr": "localhost:8080", "games": [
+				{"game_id": "1", "game_window_name": "One", "game_display_name": "One"},
+				{"game_id": "2", "capture_source": "testpattern", "game_display_name": "Two"}
+			]}`,
+		},
+		{
+			name:  "invalid addr",
+			cfg:   `{"addr": "not a host.invalid:8080", "listen_addrs": ["[::]:8080", "bad host.invalid:1"]}`,
+			paths: []string{"addr", "listen_addrs[1]"},
+		},
+		{
+			name:  "port range",
+			cfg:   `{"addr": ":8080", "ephemeral_udp_port_min": 20000, "ephemeral_udp_port_max": 10000}`,
+			paths: []string{"ephemeral_udp_port_min"},
+		},
+		{
+			name: "game fields",
+			cfg: `{"addr": ":8080", "games": [
+				{"game_id": "1", "game_window_name": "One", "game_display_name": "One"},
+				{"game_id": "2", "game_window_name": "Two", "game_display_name": "Two"},
+				{"game_id": "", "game_window_name": "", "game_display_name": "",
+					"end_game_commands": [{"process_name": "ok"}, {"process_name": ""}]}
+			]}`,
+			paths: []string{
+				"games[2].game_id",
+				"games[2].game_window_name",
+				"games[2].game_display_name",
+				"games[2].end_game_commands[1].process_name",
+			},
+		},
+		{
+			name: "duplicate game id",
+			cfg: `{"addr": ":8080", "games": [
+				{"game_id": "1", "game_window_name": "One", "game_display_name": "One"},
+				{"game_id": "2", "game_window_name": "Two", "game_display_name": "Two"},
+				{"game_id": "1", "game_window_name": "Three", "game_display_name": "Three"}
+			]}`,
+			paths: []string{"games[2].game_id"},
+		},
+		{
+			name: "capture source",
+			cfg: `{"addr": ":8080", "games": [
+				{"game_id": "1", "capture_source": "vnc", "game_display_name": "One"},
+				{"game_id": "2", "capture_source": "mediafile", "game_display_name": "Two"},
+				{"game_id": "3", "capture_source": "testpattern", "capture_mode": "screen", "game_display_name": "Three"}
+			]}`,
+			paths: []string{
+				"games[0].capture_source",
+				"games[1].media_file",
+				"games[2].capture_mode",
+			},
+		},
+		{
+			name: "capture mode",
+			cfg: `{"addr": ":8080", "games": [
+				{"game_id": "1", "capture_mode": "region", "game_window_name": "One", "game_display_name": "One"},
+				{"game_id": "2", "capture_mode": "screen", "capture_monitor": "DP-1", "game_display_name": "Two",
+					"capture_rect": {"x": -1, "y": 0, "width": 0, "height": 10}},
+				{"game_id": "3", "game_display_name": "Three", "window_match": {"title": "(", "timeout": -1}}
+			]}`,
+			paths: []string{
+				"games[0].capture_mode",
+				"games[1].capture_monitor",
+				"games[1].capture_rect.x",
+				"games[1].capture_rect.width",
+				"games[2].window_match.title",
+				"games[2].window_match.timeout",
+			},
+		},
+		{
+			name: "default codec",
+			cfg: `{"addr": ":8080", "default_codec": {"codec": "vp8", "frame_rate": 500,
+				"initial_bitrate": 40000000, "max_bitrate": 20000000}}`,
+			paths: []string{
+				"default_codec.codec",
+				"default_codec.frame_rate",
+				"default_codec.initial_bitrate",
+			},
+		},
+		{
+			name:  "ice",
+			cfg:   `{"addr": ":8080", "ice": {"servers": [{"urls": ["stun:example.com", "http://example.com"]}, {"urls": []}], "nat_1to1_ips": ["1.2.3.4", "nope"]}}`,
+			paths: []string{"ice.servers[0].urls[1]", "ice.servers[1].urls", "ice.nat_1to1_ips[1]"},
+		},
+		{
+			name:  "wrong type",
+			cfg:   `{"addr": ":8080", "default_codec": {"frame_rate": "fast"}}`,
+			paths: []string{"default_codec.frame_rate"},
+		},
+		{
+			name:  "syntax error",
+			cfg:   `{"addr": ":8080",}`,
+			paths: []string{""},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseCfg([]byte(test.cfg), "config.json", Overrides{})
+			if paths := errorPaths(t, err); !reflect.DeepEqual(paths, test.paths) {
+				t.Errorf("got error paths %q, want %q (%v)", paths, test.paths, err)
+			}
+		})
+	}
+}
+
+func TestDuplicateGameIdMessage(t *testing.T) {
+	v := &validator{}
+	v.checkGames("games", []GameConfig{
+		{GameId: "1", GameWindowName: "One", GameDisplayName: "One"},
+		{GameId: "1", GameWindowName: "Two", GameDisplayName: "Two"},
+	})
+	if len(v.errors) != 1 || v.errors[0].Error() != "games[1].game_id: duplicate of games[0].game_id" {
+		t.Errorf("got errors %v", v.err())
+	}
+}
+
+func TestCheckSessionConfigErrorPaths(t *testing.T) {
+	valid := CodecConfig{
+		Codec:          "h264_nvenc",
+		FrameRate:      60,
+		InitialBitrate: 5_000_000,
+		MaxBitrate:     30_000_000,
+	}
+	tests := []struct {
+		name  string
+		codec func(c *CodecConfig)
+		game  func(g *GameConfig)
+		paths []string
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name:  "initial bitrate above max",
+			codec: func(c *CodecConfig) { c.InitialBitrate = 40_000_000 },
+			paths: []string{"codec_config.initial_bitrate"},
+		},
+		{
+			name:  "bitrates out of bounds",
+			codec: func(c *CodecConfig) { c.InitialBitrate = 1; c.MaxBitrate = MaxBitrate + 1 },
+			paths: []string{"codec_config.initial_bitrate", "codec_config.max_bitrate"},
+		},
+		{
+			name:  "unknown codec",
+			codec: func(c *CodecConfig) { c.Codec = "" },
+			paths: []string{"codec_config.codec"},
+		},
+		{
+			name:  "missing game id",
+			game:  func(g *GameConfig) { g.GameId = "" },
+			paths: []string{"game_config.game_id"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &SessionConfig{
+				GameConfig:  GameConfig{GameId: "1", GameWindowName: "One", GameDisplayName: "One"},
+				CodecConfig: valid,
+			}
+			if test.codec != nil {
+				test.codec(&c.CodecConfig)
+			}
+			if test.game != nil {
+				test.game(&c.GameConfig)
+			}
+			if paths := errorPaths(t, CheckSessionConfig(c)); !reflect.DeepEqual(paths, test.paths) {
+				t.Errorf("got error paths %q, want %q", paths, test.paths)
+			}
+		})
+	}
+}
+
+func TestIsValidAddr(t *testing.T) {
+	tests := []struct {
+		addr  string
+		valid bool
+	}{
+		{"", true},
+		{":8080", true},
+		{"0.0.0.0:8080", true},
+		{"[::]:8080", true},
+		{"[::1]:8080", true},
+		{"localhost:8080", true},
+		{"localhost", true},
+		{"192.168.1.10", true},
+		{"game-server.lan:8080", true},
+		{"not a host.invalid:8080", false},
+		{"-leading.dash.invalid:8080", false},
+		{"under_score.invalid:8080", false},
+	}
+	for _, test := range tests {
+		addr := test.addr
+		if got := isValidAddr(&addr); got != test.valid {
+			t.Errorf("isValidAddr(%q) = %v, want %v", test.addr, got, test.valid)
+		}
+	}
+}
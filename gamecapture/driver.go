@@ -0,0 +1,150 @@
+package gamecapture
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/3DRX/vaporplay/config"
+	"github.com/pion/mediadevices/pkg/driver"
+	"github.com/pion/mediadevices/pkg/frame"
+	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/mediadevices/pkg/prop"
+)
+
+// captureDriver adapts a CaptureSource to a mediadevices video driver.
+// Frames keep the size the source had when the driver was opened, since the
+// encoder can't change its size mid-stream, frames of a resized source are
+// cropped or padded to it.
+type captureDriver struct {
+	label  string
+	source CaptureSource
+	width  int
+	height int
+	// lock keeps the source from being closed while a frame is read
+	lock   sync.Mutex
+	tick   *time.Ticker
+	closed chan struct{}
+}
+
+func captureLabel(sourceName string, gameCfg *config.GameConfig) string {
+	return fmt.Sprintf("%s_%s", sourceName, gameCfg.GameId)
+}
+
+func registerDriver(sourceName string, gameCfg *config.GameConfig, source CaptureSource) string {
+	label := captureLabel(sourceName, gameCfg)
+	slog.Info("initializing game capture", "source", sourceName, "label", label)
+	driver.GetManager().Register(
+		&captureDriver{
+			label:  label,
+			source: source,
+		},
+		driver.Info{
+			Label:      label,
+			DeviceType: driver.Camera,
+		},
+	)
+	return label
+}
+
+func (d *captureDriver) Open() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.closed = make(chan struct{})
+	if err := d.source.Open(); err != nil {
+		return err
+	}
+	d.width, d.height = d.source.Size()
+	d.source.OnResize(func(width int, height int) {
+		slog.Info("capture size changed", "label", d.label, "width", width, "height", height, "frame width", d.width, "frame height", d.height)
+	})
+	return nil
+}
+
+func (d *captureDriver) Close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.tick != nil {
+		d.tick.Stop()
+		d.tick = nil
+	}
+	// the driver may be closed before it was opened, or twice
+	if d.closed != nil {
+		select {
+		case <-d.closed:
+		default:
+			close(d.closed)
+		}
+	}
+	return d.source.Close()
+}
+
+func (d *captureDriver) VideoRecord(p prop.Media) (video.Reader, error) {
+	if p.FrameRate == 0 {
+		p.FrameRate = 10
+	}
+	tick := time.NewTicker(time.Duration(float32(time.Second) / p.FrameRate))
+	d.lock.Lock()
+	d.tick = tick
+	closed := d.closed
+	d.lock.Unlock()
+
+	var dst image.RGBA
+	var fitted *image.RGBA
+	r := video.ReaderFunc(func() (image.Image, func(), error) {
+		select {
+		case <-tick.C:
+		case <-closed:
+			return nil, func() {}, io.EOF
+		}
+		img, err := d.read(&dst)
+		if err != nil {
+			return nil, func() {}, err
+		}
+		if img.Rect.Dx() != d.width || img.Rect.Dy() != d.height {
+			if fitted == nil {
+				fitted = image.NewRGBA(image.Rect(0, 0, d.width, d.height))
+			}
+			fit(fitted, img)
+			img = fitted
+		}
+		return img, func() {}, nil
+	})
+	return r, nil
+}
+
+// read reads a frame unless the driver was closed.
+func (d *captureDriver) read(dst *image.RGBA) (*image.RGBA, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	select {
+	case <-d.closed:
+		return nil, io.EOF
+	default:
+	}
+	return d.source.Read(dst)
+}
+
+// fit copies src to the top left of dst, cropping what doesn't fit and
+// leaving the rest black.
+func fit(dst *image.RGBA, src *image.RGBA) {
+	clear(dst.Pix)
+	draw.Draw(dst, dst.Rect, src, src.Rect.Min, draw.Src)
+}
+
+func (d *captureDriver) Properties() []prop.Media {
+	return []prop.Media{
+		{
+			DeviceID: d.label,
+			Video: prop.Video{
+				Width:       d.width,
+				Height:      d.height,
+				FrameFormat: frame.FormatRGBA,
+			},
+		},
+	}
+}
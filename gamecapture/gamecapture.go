@@ -1,7 +1,7 @@
 package gamecapture
 
 /*
-#cgo LDFLAGS: -lX11 -lXext
+#cgo LDFLAGS: -lX11 -lXext -lXrandr
 #include "game_capture.h"
 #include "window_match.h"
 #include <X11/Xlib.h>
@@ -22,6 +22,8 @@ import (
 	"image"
 	"image/color"
 	"unsafe"
+
+	"github.com/3DRX/vaporplay/config"
 )
 
 const shmaddrInvalid = ^uintptr(0)
@@ -37,10 +39,10 @@ const (
 	pixFmtRGB16
 )
 
-func openWindow(windowname string) (*windowmatch, error) {
-	cstr := C.CString(windowname)
-	defer C.free(unsafe.Pointer(cstr))
-	wm := C.query_window_by_name(cstr)
+// openRoot opens the root window, which the screen and monitor capture
+// modes read from.
+func openRoot() (*windowmatch, error) {
+	wm := C.query_root_window()
 	if wm == nil {
 		return nil, errors.New("failed to open display")
 	}
@@ -195,15 +197,14 @@ func (s *shmImage) ToRGBA(dst *image.RGBA) *image.RGBA {
 	}
 }
 
-func newShmImage(dp *C.Display, window C.Window) (*shmImage, error) {
+// newShmImage creates an image of w by h pixels for reading from window.
+func newShmImage(dp *C.Display, window C.Window, w int, h int) (*shmImage, error) {
 	windAttrs := C.XWindowAttributes{}
 	if res := C.XGetWindowAttributes(dp, window, &windAttrs); res == 0 {
 		return nil, errors.New("failed to get window attributes")
 	}
 
-	fmt.Printf("Capturing window %dx%d ...\n", windAttrs.width, windAttrs.height)
-	w := int(windAttrs.width)
-	h := int(windAttrs.height)
+	fmt.Printf("Capturing window %dx%d ...\n", w, h)
 	v := windAttrs.visual
 	depth := int(windAttrs.depth)
 
@@ -248,48 +249,133 @@ func newShmImage(dp *C.Display, window C.Window) (*shmImage, error) {
 	return s, nil
 }
 
+func windowSize(dp *C.Display, window C.Window) (int, int, error) {
+	windAttrs := C.XWindowAttributes{}
+	if res := C.XGetWindowAttributes(dp, window, &windAttrs); res == 0 {
+		return 0, 0, errors.New("failed to get window attributes")
+	}
+	return int(windAttrs.width), int(windAttrs.height), nil
+}
+
+// ErrMonitorNotFound is returned when the monitor capture mode names a
+// monitor XRandR doesn't know.
+var ErrMonitorNotFound = errors.New("monitor not found")
+
+// captureArea is what a reader captures: the game window, or the root
+// window in the screen and monitor modes, limited to a monitor and to rect.
+type captureArea struct {
+	mode    string
+	monitor string
+	rect    *config.CaptureRect
+}
+
+func newCaptureArea(gameCfg *config.GameConfig) captureArea {
+	a := captureArea{
+		mode:    gameCfg.CaptureMode,
+		monitor: gameCfg.CaptureMonitor,
+		rect:    gameCfg.CaptureRect,
+	}
+	if a.mode == "" {
+		a.mode = config.DefaultCaptureMode
+	}
+	return a
+}
+
 type reader struct {
-	img *shmImage
-	wm  *windowmatch
+	img  *shmImage
+	wm   *windowmatch
+	area captureArea
+	// bounds is the part of the window that is read
+	bounds image.Rectangle
 }
 
-func getShmImageFromWindowMatch(wm *windowmatch) (*shmImage, error) {
+// newReader reads area from the window of wm, the game window or the root
+// window, and takes over wm. wm is closed if it fails.
+func newReader(wm *windowmatch, area captureArea) (*reader, error) {
 	if C.XShmQueryExtension(wm.display) == 0 {
+		wm.Close()
 		return nil, errors.New("no XShm support")
 	}
 
-	img, err := newShmImage(wm.display, wm.window)
+	r := &reader{
+		wm:   wm,
+		area: area,
+	}
+	var err error
+	r.bounds, err = r.captureBounds()
 	if err != nil {
 		wm.Close()
 		return nil, err
 	}
-
-	return img, nil
+	r.img, err = newShmImage(wm.display, wm.window, r.bounds.Dx(), r.bounds.Dy())
+	if err != nil {
+		wm.Close()
+		return nil, err
+	}
+	return r, nil
 }
 
-func newReader(windowname string) (*reader, error) {
-	wm, err := openWindow(windowname)
-	if err != nil || wm == nil {
-		return nil, errors.New("failed to open display")
-	}
+// errWindowGone is returned when the captured window was destroyed.
+var errWindowGone = errors.New("window is gone")
 
-	img, err := getShmImageFromWindowMatch(wm)
+// captureBounds works out the part of the window to read, which follows
+// the size of the window and the monitor layout.
+func (r *reader) captureBounds() (image.Rectangle, error) {
+	w, h, err := windowSize(r.wm.display, r.wm.window)
 	if err != nil {
-		return nil, err
+		return image.Rectangle{}, errWindowGone
 	}
-
-	return &reader{
-		img: img,
-		wm:  wm,
-	}, nil
+	window := image.Rect(0, 0, w, h)
+	bounds := window
+	if r.area.mode == "monitor" {
+		name := C.CString(r.area.monitor)
+		defer C.free(unsafe.Pointer(name))
+		var x, y, width, height C.int
+		if C.query_monitor(r.wm.display, name, &x, &y, &width, &height) == 0 {
+			if r.area.monitor == "" {
+				return image.Rectangle{}, fmt.Errorf("%w: no primary monitor", ErrMonitorNotFound)
+			}
+			return image.Rectangle{}, fmt.Errorf("%w: %q", ErrMonitorNotFound, r.area.monitor)
+		}
+		bounds = image.Rect(int(x), int(y), int(x+width), int(y+height)).Intersect(window)
+	}
+	if rect := r.area.rect; rect != nil {
+		bounds = image.Rect(rect.X, rect.Y, rect.X+rect.Width, rect.Y+rect.Height).Add(bounds.Min).Intersect(bounds)
+	}
+	if bounds.Empty() {
+		return image.Rectangle{}, fmt.Errorf("capture area is outside of the %dx%d window", w, h)
+	}
+	return bounds, nil
 }
 
 func (r *reader) Size() (int, int) {
 	return int(r.img.img.width), int(r.img.img.height)
 }
 
+// refresh recreates the shared memory image when the captured area was
+// resized, and reports whether it did.
+func (r *reader) refresh() (bool, error) {
+	bounds, err := r.captureBounds()
+	if err != nil {
+		return false, err
+	}
+	if bounds.Dx() == r.bounds.Dx() && bounds.Dy() == r.bounds.Dy() {
+		// the area may still have moved, like a monitor in the layout
+		r.bounds = bounds
+		return false, nil
+	}
+	img, err := newShmImage(r.wm.display, r.wm.window, bounds.Dx(), bounds.Dy())
+	if err != nil {
+		return false, err
+	}
+	r.img.Free()
+	r.img = img
+	r.bounds = bounds
+	return true, nil
+}
+
 func (r *reader) Read() *shmImage {
-	C.XShmGetImage(r.wm.display, r.wm.window, r.img.img, 0, 0, C.AllPlanes)
+	C.XShmGetImage(r.wm.display, r.wm.window, r.img.img, C.int(r.bounds.Min.X), C.int(r.bounds.Min.Y), C.AllPlanes)
 	r.img.b = C.GoBytes(
 		unsafe.Pointer(r.img.img.data),
 		C.int(r.img.img.width*r.img.img.height*4),
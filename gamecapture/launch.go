@@ -0,0 +1,31 @@
+package gamecapture
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+
+	"github.com/3DRX/vaporplay/config"
+)
+
+const (
+	STEAM_CMD = "steam"
+	STEAM_URL = "steam://rungameid/%s"
+)
+
+// ErrLaunchFailed is returned when steam fails to start the game.
+var ErrLaunchFailed = errors.New("failed to launch game")
+
+// LaunchGame asks steam to start the game, unless its id is "000000".
+func LaunchGame(gameCfg *config.GameConfig) error {
+	if gameCfg.GameId == "000000" {
+		slog.Info("no game id specified, skipping game start")
+		return nil
+	}
+	cmd := exec.Command(STEAM_CMD, fmt.Sprintf(STEAM_URL, gameCfg.GameId))
+	if _, err := cmd.Output(); err != nil {
+		return fmt.Errorf("%w %s: %w", ErrLaunchFailed, gameCfg.GameId, err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package gamecapture
+
+/*
+#include "window_match.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/3DRX/vaporplay/config"
+)
+
+// windowMatcher picks the game window out of all windows of the display.
+type windowMatcher struct {
+	gameId string
+	// name has to be contained in the title or class when no other
+	// criterion is set
+	name      string
+	pid       bool
+	class     string
+	title     *regexp.Regexp
+	minWidth  int
+	minHeight int
+	timeout   time.Duration
+}
+
+func newWindowMatcher(gameCfg *config.GameConfig) (*windowMatcher, error) {
+	m := &windowMatcher{
+		gameId:    gameCfg.GameId,
+		minWidth:  config.DefaultWindowMinWidth,
+		minHeight: config.DefaultWindowMinHeight,
+		timeout:   config.DefaultWindowTimeout * time.Second,
+	}
+	c := gameCfg.WindowMatch
+	if !c.HasCriteria() {
+		m.name = gameCfg.GameWindowName
+	}
+	if c == nil {
+		return m, nil
+	}
+	m.pid = c.PID
+	m.class = c.Class
+	if c.Title != "" {
+		title, err := regexp.Compile(c.Title)
+		if err != nil {
+			return nil, fmt.Errorf("window title: %w", err)
+		}
+		m.title = title
+	}
+	if c.MinWidth != 0 {
+		m.minWidth = c.MinWidth
+	}
+	if c.MinHeight != 0 {
+		m.minHeight = c.MinHeight
+	}
+	if c.Timeout != 0 {
+		m.timeout = time.Duration(c.Timeout) * time.Second
+	}
+	return m, nil
+}
+
+// String describes the windows m matches, for logs and errors.
+func (m *windowMatcher) String() string {
+	var criteria []string
+	if m.name != "" {
+		criteria = append(criteria, fmt.Sprintf("named %q", m.name))
+	}
+	if m.pid {
+		criteria = append(criteria, "of the processes of game "+m.gameId)
+	}
+	if m.class != "" {
+		criteria = append(criteria, fmt.Sprintf("of class %q", m.class))
+	}
+	if m.title != nil {
+		criteria = append(criteria, fmt.Sprintf("with a title matching %q", m.title))
+	}
+	criteria = append(criteria, fmt.Sprintf("of at least %dx%d", m.minWidth, m.minHeight))
+	return "window " + strings.Join(criteria, ", ")
+}
+
+// find looks for the game window once, it returns nil if there is none.
+func (m *windowMatcher) find() (*windowmatch, error) {
+	dp := C.open_display()
+	if dp == nil {
+		return nil, errors.New("failed to open display")
+	}
+	var pids map[int]bool
+	if m.pid {
+		var err error
+		pids, err = gameProcesses(m.gameId)
+		if err != nil || len(pids) == 0 {
+			C.XCloseDisplay(dp)
+			return nil, err
+		}
+	}
+	var count C.uint
+	list := C.list_windows(dp, &count)
+	defer C.free(unsafe.Pointer(list))
+	if list == nil {
+		C.XCloseDisplay(dp)
+		return nil, nil
+	}
+	for _, window := range unsafe.Slice(list, count) {
+		if m.matches(dp, window, pids) {
+			wm := (*C.WindowMatch)(C.malloc(C.sizeof_WindowMatch))
+			wm.display = dp
+			wm.window = window
+			return (*windowmatch)(wm), nil
+		}
+	}
+	C.XCloseDisplay(dp)
+	return nil, nil
+}
+
+func (m *windowMatcher) matches(dp *C.Display, window C.Window, pids map[int]bool) bool {
+	if m.pid && !pids[int(C.window_pid(dp, window))] {
+		return false
+	}
+	var resName, resClass string
+	if m.name != "" || m.class != "" {
+		hint := C.XClassHint{}
+		if C.XGetClassHint(dp, window, &hint) != 0 {
+			resName = C.GoString(hint.res_name)
+			resClass = C.GoString(hint.res_class)
+			C.XFree(unsafe.Pointer(hint.res_name))
+			C.XFree(unsafe.Pointer(hint.res_class))
+		}
+	}
+	if m.class != "" && resName != m.class && resClass != m.class {
+		return false
+	}
+	var title string
+	if m.name != "" || m.title != nil {
+		if t := C.window_title(dp, window); t != nil {
+			title = C.GoString(t)
+			C.free(unsafe.Pointer(t))
+		}
+	}
+	if m.title != nil && !m.title.MatchString(title) {
+		return false
+	}
+	if m.name != "" && !strings.Contains(title, m.name) &&
+		!strings.Contains(resName, m.name) && !strings.Contains(resClass, m.name) {
+		return false
+	}
+	w, h, err := windowSize(dp, window)
+	return err == nil && w >= m.minWidth && h >= m.minHeight
+}
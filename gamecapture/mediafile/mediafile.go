@@ -0,0 +1,319 @@
+// Package mediafile adds the mediafile capture source to gamecapture, it
+// plays the video stream of a local file with FFmpeg. Import it for its
+// side effect.
+package mediafile
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/3DRX/vaporplay/config"
+	"github.com/3DRX/vaporplay/gamecapture"
+	"github.com/asticode/go-astiav"
+)
+
+// defaultFrameRate is used for streams that don't tell their frame rate.
+const defaultFrameRate = 30
+
+func init() {
+	gamecapture.RegisterSource("mediafile", gamecapture.Source{
+		New: newMediaFileSource,
+	})
+}
+
+// mediaFileSource decodes the video stream of a file as fast as Read asks
+// for frames, but only moves on to a frame once its timestamp is due, so
+// frames are delivered at the frame rate of the file whatever the frame
+// rate of the encoder is.
+type mediaFileSource struct {
+	path string
+	loop bool
+	seek float64
+
+	formatCtx *astiav.FormatContext
+	stream    *astiav.Stream
+	decoder   *astiav.Codec
+	decodeCtx *astiav.CodecContext
+	scaleCtx  *astiav.SoftwareScaleContext
+	pkt       *astiav.Packet
+	frame     *astiav.Frame
+	dueFrame  *astiav.Frame
+	bgraFrame *astiav.Frame
+
+	width         int
+	height        int
+	frameDuration float64
+	img           *image.RGBA
+	// start is when the frame at seek is due
+	start time.Time
+	// position of the decoded frame that is not shown yet, in seconds
+	position float64
+	pending  bool
+	ended    bool
+}
+
+func newMediaFileSource(gameCfg *config.GameConfig, _ <-chan struct{}) (gamecapture.CaptureSource, error) {
+	c := gameCfg.MediaFile
+	if c == nil {
+		return nil, errors.New("no media_file in game config")
+	}
+	if _, err := os.Stat(c.Path); err != nil {
+		return nil, err
+	}
+	return &mediaFileSource{
+		path: c.Path,
+		loop: c.Loop,
+		seek: c.Seek,
+	}, nil
+}
+
+func (s *mediaFileSource) Open() error {
+	astiav.SetLogLevel(astiav.LogLevel(astiav.LogLevelWarning))
+	if err := s.open(); err != nil {
+		s.Close()
+		return fmt.Errorf("opening %s: %w", s.path, err)
+	}
+	slog.Info("playing media file", "path", s.path, "width", s.width, "height", s.height, "frame duration", s.frameDuration, "loop", s.loop, "seek", s.seek)
+	return nil
+}
+
+func (s *mediaFileSource) open() error {
+	if s.formatCtx = astiav.AllocFormatContext(); s.formatCtx == nil {
+		return errors.New("failed to allocate format context")
+	}
+	if err := s.formatCtx.OpenInput(s.path, nil, nil); err != nil {
+		// OpenInput frees the context when it fails
+		s.formatCtx = nil
+		return err
+	}
+	if err := s.formatCtx.FindStreamInfo(nil); err != nil {
+		return err
+	}
+	stream, decoder, err := s.formatCtx.FindBestStream(astiav.MediaType(astiav.MediaTypeVideo), -1, -1)
+	if err != nil {
+		return fmt.Errorf("no video stream: %w", err)
+	}
+	s.stream = stream
+	s.decoder = decoder
+	frameRate := stream.AvgFrameRate().Float64()
+	if frameRate <= 0 {
+		frameRate = defaultFrameRate
+	}
+	s.frameDuration = 1 / frameRate
+	if err := s.openDecoder(); err != nil {
+		return err
+	}
+	s.pkt = astiav.AllocPacket()
+	s.frame = astiav.AllocFrame()
+	s.dueFrame = astiav.AllocFrame()
+	s.bgraFrame = astiav.AllocFrame()
+
+	// encoders only take even sizes
+	width, height := s.decodeCtx.Width(), s.decodeCtx.Height()
+	s.width = width &^ 1
+	s.height = height &^ 1
+	if s.width == 0 || s.height == 0 {
+		return fmt.Errorf("video stream is %dx%d", width, height)
+	}
+	s.scaleCtx, err = astiav.CreateSoftwareScaleContext(
+		width, height, s.decodeCtx.PixelFormat(),
+		s.width, s.height, astiav.PixelFormat(astiav.PixelFormatBgra),
+		astiav.NewSoftwareScaleContextFlags(astiav.SoftwareScaleContextFlag(astiav.SoftwareScaleContextFlagBilinear)),
+	)
+	if err != nil {
+		return err
+	}
+	s.img = image.NewRGBA(image.Rect(0, 0, s.width, s.height))
+	return s.rewind()
+}
+
+// openDecoder creates a new decoder context, which is also how the decoder
+// is reset after it returned its last frame.
+func (s *mediaFileSource) openDecoder() error {
+	if s.decodeCtx != nil {
+		s.decodeCtx.Free()
+	}
+	if s.decodeCtx = astiav.AllocCodecContext(s.decoder); s.decodeCtx == nil {
+		return errors.New("failed to allocate codec context")
+	}
+	if err := s.stream.CodecParameters().ToCodecContext(s.decodeCtx); err != nil {
+		return err
+	}
+	return s.decodeCtx.Open(s.decoder, nil)
+}
+
+// rewind seeks to the start position and decodes the first frame at or
+// after it, which is due right away.
+func (s *mediaFileSource) rewind() error {
+	timeBase := s.stream.TimeBase()
+	ts := int64(s.seek * float64(timeBase.Den()) / float64(timeBase.Num()))
+	if start := s.stream.StartTime(); start != astiav.NoPtsValue {
+		ts += start
+	}
+	if err := s.formatCtx.SeekFrame(s.stream.Index(), ts, astiav.NewSeekFlags(astiav.SeekFlag(astiav.SeekFlagBackward))); err != nil {
+		return fmt.Errorf("seeking to %gs: %w", s.seek, err)
+	}
+	if err := s.openDecoder(); err != nil {
+		return err
+	}
+	s.position = -1
+	s.pending = false
+	// seeking lands on the key frame before the start position
+	for !s.pending || s.position < s.seek-s.frameDuration/2 {
+		if err := s.decode(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("nothing to play after %gs", s.seek)
+			}
+			return err
+		}
+	}
+	s.start = time.Now()
+	s.ended = false
+	return nil
+}
+
+// decode decodes the next frame into frame, io.EOF is returned after the
+// last one.
+func (s *mediaFileSource) decode() error {
+	for {
+		err := s.decodeCtx.ReceiveFrame(s.frame)
+		if err == nil {
+			break
+		}
+		if errors.Is(err, astiav.ErrEof) {
+			s.pending = false
+			return io.EOF
+		}
+		if !errors.Is(err, astiav.ErrEagain) {
+			return fmt.Errorf("receiving frame: %w", err)
+		}
+		// the decoder needs another packet
+		if err := s.sendPacket(); err != nil {
+			return err
+		}
+	}
+	previous := s.position
+	s.position = previous + s.frameDuration
+	if pts := s.frame.Pts(); pts != astiav.NoPtsValue {
+		if start := s.stream.StartTime(); start != astiav.NoPtsValue {
+			pts -= start
+		}
+		s.position = float64(pts) * s.stream.TimeBase().Float64()
+	}
+	s.pending = true
+	return nil
+}
+
+// sendPacket sends the next packet of the video stream to the decoder, at
+// the end of the file it asks the decoder for the frames it still holds.
+func (s *mediaFileSource) sendPacket() error {
+	for {
+		err := s.formatCtx.ReadFrame(s.pkt)
+		if errors.Is(err, astiav.ErrEof) {
+			return s.decodeCtx.SendPacket(nil)
+		}
+		if err != nil {
+			return fmt.Errorf("reading packet: %w", err)
+		}
+		if s.pkt.StreamIndex() != s.stream.Index() {
+			s.pkt.Unref()
+			continue
+		}
+		err = s.decodeCtx.SendPacket(s.pkt)
+		s.pkt.Unref()
+		if err != nil {
+			return fmt.Errorf("sending packet: %w", err)
+		}
+		return nil
+	}
+}
+
+// Read shows the last frame that is due. At the end of the file it starts
+// over if the source loops and holds the last frame otherwise.
+func (s *mediaFileSource) Read(dst *image.RGBA) (*image.RGBA, error) {
+	elapsed := time.Since(s.start).Seconds()
+	due := false
+	for s.pending && s.position-s.seek <= elapsed {
+		// frames that are due together are dropped but the last one, when
+		// the encoder reads slower than the file plays
+		s.dueFrame.Unref()
+		s.dueFrame.MoveRef(s.frame)
+		due = true
+		err := s.decode()
+		if errors.Is(err, io.EOF) {
+			if !s.loop {
+				if !s.ended {
+					slog.Info("media file ended", "path", s.path)
+					s.ended = true
+				}
+				break
+			}
+			if err := s.rewind(); err != nil {
+				return nil, err
+			}
+			elapsed = 0
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if due {
+		if err := s.scaleCtx.ScaleFrame(s.dueFrame, s.bgraFrame); err != nil {
+			return nil, fmt.Errorf("converting frame: %w", err)
+		}
+		s.dueFrame.Unref()
+		if err := s.bgraFrame.Data().ToImage(s.img); err != nil {
+			return nil, err
+		}
+		s.bgraFrame.Unref()
+	}
+	return s.img, nil
+}
+
+func (s *mediaFileSource) Size() (int, int) {
+	return s.width, s.height
+}
+
+// OnResize does nothing, frames are scaled to the size of the stream.
+func (s *mediaFileSource) OnResize(f func(width int, height int)) {}
+
+func (s *mediaFileSource) Close() error {
+	// the source may be closed before it was opened, or twice
+	if s.scaleCtx != nil {
+		s.scaleCtx.Free()
+		s.scaleCtx = nil
+	}
+	if s.bgraFrame != nil {
+		s.bgraFrame.Free()
+		s.bgraFrame = nil
+	}
+	if s.frame != nil {
+		s.frame.Free()
+		s.frame = nil
+	}
+	if s.dueFrame != nil {
+		s.dueFrame.Free()
+		s.dueFrame = nil
+	}
+	if s.pkt != nil {
+		s.pkt.Free()
+		s.pkt = nil
+	}
+	if s.decodeCtx != nil {
+		s.decodeCtx.Free()
+		s.decodeCtx = nil
+	}
+	if s.formatCtx != nil {
+		s.formatCtx.CloseInput()
+		s.formatCtx.Free()
+		s.formatCtx = nil
+	}
+	s.pending = false
+	return nil
+}
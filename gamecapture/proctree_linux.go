@@ -0,0 +1,65 @@
+package gamecapture
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// gameProcesses returns the ids of the process tree Steam launched the game
+// in: the processes with AppId=<gameId> on their command line, like Steam's
+// reaper, and all their descendants.
+func gameProcesses(gameId string) (map[int]bool, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	marker := []byte("AppId=" + gameId)
+	parents := map[int]int{}
+	pids := map[int]bool{}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		// processes may exit while we look at them
+		stat, err := os.ReadFile("/proc/" + entry.Name() + "/stat")
+		if err != nil {
+			continue
+		}
+		// the command name is in parentheses and may contain anything,
+		// the state and the parent id follow it
+		fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+		if len(fields) < 2 {
+			continue
+		}
+		ppid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		parents[pid] = ppid
+		cmdline, err := os.ReadFile("/proc/" + entry.Name() + "/cmdline")
+		if err != nil {
+			continue
+		}
+		for _, arg := range bytes.Split(cmdline, []byte{0}) {
+			if bytes.Equal(arg, marker) {
+				pids[pid] = true
+			}
+		}
+	}
+	if len(pids) == 0 {
+		return pids, nil
+	}
+	for pid := range parents {
+		// a parent chain ends at init, or at a process that exited
+		for p, depth := pid, 0; p > 1 && depth < len(parents); p, depth = parents[p], depth+1 {
+			if pids[p] {
+				pids[pid] = true
+				break
+			}
+		}
+	}
+	return pids, nil
+}
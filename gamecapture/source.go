@@ -0,0 +1,106 @@
+package gamecapture
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"sort"
+	"sync"
+
+	"github.com/3DRX/vaporplay/config"
+)
+
+// CaptureSource produces the frames of a capture driver. Frames carry BGRA
+// pixels in an image.RGBA, which is the layout the encoders are set up for.
+type CaptureSource interface {
+	// Open starts capturing, it is called once before the first Read.
+	Open() error
+	// Read returns the current frame, dst may be reused for it.
+	Read(dst *image.RGBA) (*image.RGBA, error)
+	// Size returns the size of the frames.
+	Size() (width int, height int)
+	// OnResize sets a function that is called with the new size when the
+	// size of the frames changes.
+	OnResize(f func(width int, height int))
+	Close() error
+}
+
+// Source is a kind of capture source a game config can pick by name.
+type Source struct {
+	// New creates the capture source of a game, it may block until there
+	// is something to capture, like the game window, or cancel is closed.
+	New func(gameCfg *config.GameConfig, cancel <-chan struct{}) (CaptureSource, error)
+	// CapturesGame is set for sources that capture the game itself, the
+	// game is launched before New is called.
+	CapturesGame bool
+}
+
+// ErrUnknownSource is returned for a capture source nobody registered.
+var ErrUnknownSource = errors.New("unknown capture source")
+
+// ErrCanceled is returned when the session ends while the capture source
+// waits for something to capture.
+var ErrCanceled = errors.New("capture canceled")
+
+var (
+	sources     = map[string]Source{}
+	sourcesLock sync.Mutex
+)
+
+// RegisterSource makes a capture source available under name.
+func RegisterSource(name string, source Source) {
+	sourcesLock.Lock()
+	defer sourcesLock.Unlock()
+	sources[name] = source
+}
+
+// Sources lists the names of the registered capture sources.
+func Sources() []string {
+	sourcesLock.Lock()
+	defer sourcesLock.Unlock()
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sourceName(gameCfg *config.GameConfig) string {
+	if gameCfg.CaptureSource == "" {
+		return config.DefaultCaptureSource
+	}
+	return gameCfg.CaptureSource
+}
+
+func lookupSource(name string) (Source, error) {
+	sourcesLock.Lock()
+	defer sourcesLock.Unlock()
+	source, ok := sources[name]
+	if !ok {
+		return Source{}, fmt.Errorf("%w %q", ErrUnknownSource, name)
+	}
+	return source, nil
+}
+
+// Initialize launches the game if its capture source captures the game,
+// creates the capture source and registers a capture driver for it. It
+// returns the label of the driver. Waiting for the capture source stops
+// when cancel is closed.
+func Initialize(gameCfg *config.GameConfig, cancel <-chan struct{}) (string, error) {
+	name := sourceName(gameCfg)
+	source, err := lookupSource(name)
+	if err != nil {
+		return "", err
+	}
+	if source.CapturesGame {
+		if err := LaunchGame(gameCfg); err != nil {
+			return "", err
+		}
+	}
+	captureSource, err := source.New(gameCfg, cancel)
+	if err != nil {
+		return "", err
+	}
+	return registerDriver(name, gameCfg, captureSource), nil
+}
@@ -0,0 +1,254 @@
+package gamecapture
+
+import (
+	"encoding/binary"
+	"image"
+	"strconv"
+	"time"
+
+	"github.com/3DRX/vaporplay/config"
+)
+
+// Defaults of the testpattern source.
+const (
+	DefaultTestPatternWidth     = 1280
+	DefaultTestPatternHeight    = 720
+	DefaultTestPatternFrameRate = 60
+)
+
+// The barcode at the bottom of a test pattern frame is a row of
+// barcodeCells cells of equal width: a white start cell, the frame id in 32
+// cells, the unix time in milliseconds the frame was drawn at in 64 cells
+// and a white stop cell. Bits are most significant first, white is 1.
+const (
+	barcodeIDBits   = 32
+	barcodeTimeBits = 64
+	barcodeCells    = 1 + barcodeIDBits + barcodeTimeBits + 1
+)
+
+// barColors are the moving color bars: white, yellow, cyan, green,
+// magenta, red and blue, as BGR.
+var barColors = [][3]uint8{
+	{0xC0, 0xC0, 0xC0},
+	{0x00, 0xC0, 0xC0},
+	{0xC0, 0xC0, 0x00},
+	{0x00, 0xC0, 0x00},
+	{0xC0, 0x00, 0xC0},
+	{0x00, 0x00, 0xC0},
+	{0xC0, 0x00, 0x00},
+}
+
+// digitFont has a 3x5 bitmap of every digit, one row per element.
+var digitFont = [10][5]uint8{
+	{0b111, 0b101, 0b101, 0b101, 0b111},
+	{0b010, 0b110, 0b010, 0b010, 0b111},
+	{0b111, 0b001, 0b111, 0b100, 0b111},
+	{0b111, 0b001, 0b111, 0b001, 0b111},
+	{0b101, 0b101, 0b111, 0b001, 0b001},
+	{0b111, 0b100, 0b111, 0b001, 0b111},
+	{0b111, 0b100, 0b111, 0b101, 0b111},
+	{0b111, 0b001, 0b001, 0b001, 0b001},
+	{0b111, 0b101, 0b111, 0b101, 0b111},
+	{0b111, 0b101, 0b111, 0b001, 0b111},
+}
+
+func init() {
+	RegisterSource("testpattern", Source{
+		New: newTestPatternSource,
+	})
+}
+
+// testPatternSource draws synthetic frames at its own frame rate: color bars
+// that move by a few pixels every frame, the frame id as a number and a
+// barcode with the frame id and the time it was drawn at, so that a client
+// can measure latency and frame drops without a game or an X server.
+type testPatternSource struct {
+	width     int
+	height    int
+	frameRate float32
+	start     time.Time
+	img       *image.RGBA
+	lastID    int64
+}
+
+func newTestPatternSource(gameCfg *config.GameConfig, _ <-chan struct{}) (CaptureSource, error) {
+	s := &testPatternSource{
+		width:     DefaultTestPatternWidth,
+		height:    DefaultTestPatternHeight,
+		frameRate: DefaultTestPatternFrameRate,
+	}
+	if c := gameCfg.TestPattern; c != nil {
+		if c.Width != 0 {
+			s.width = c.Width
+		}
+		if c.Height != 0 {
+			s.height = c.Height
+		}
+		if c.FrameRate != 0 {
+			s.frameRate = c.FrameRate
+		}
+	}
+	return s, nil
+}
+
+func (s *testPatternSource) Open() error {
+	s.img = image.NewRGBA(image.Rect(0, 0, s.width, s.height))
+	s.start = time.Now()
+	s.lastID = -1
+	return nil
+}
+
+// Read draws the frame that is due, a frame is returned again until the
+// next one is due.
+func (s *testPatternSource) Read(dst *image.RGBA) (*image.RGBA, error) {
+	now := time.Now()
+	id := int64(now.Sub(s.start).Seconds() * float64(s.frameRate))
+	if id != s.lastID {
+		s.lastID = id
+		s.draw(uint32(id), now)
+	}
+	return s.img, nil
+}
+
+func (s *testPatternSource) Size() (int, int) {
+	return s.width, s.height
+}
+
+// OnResize does nothing, test patterns keep their size.
+func (s *testPatternSource) OnResize(f func(width int, height int)) {}
+
+func (s *testPatternSource) Close() error {
+	return nil
+}
+
+func (s *testPatternSource) draw(id uint32, now time.Time) {
+	s.drawBars(id)
+	scale := max(s.height/60, 1)
+	s.drawNumber(id, scale, scale, scale)
+	s.drawBarcode(id, now)
+}
+
+// drawBars draws the first row of the bars and copies it to the others.
+func (s *testPatternSource) drawBars(id uint32) {
+	img := s.img
+	barWidth := max(s.width/len(barColors), 1)
+	offset := int(id) * max(s.width/240, 1)
+	row := img.Pix[:s.width*4]
+	for x := 0; x < s.width; x++ {
+		c := barColors[((x+offset)/barWidth)%len(barColors)]
+		i := x * 4
+		row[i] = c[0]
+		row[i+1] = c[1]
+		row[i+2] = c[2]
+		row[i+3] = 0xFF
+	}
+	for y := 1; y < s.height; y++ {
+		copy(img.Pix[y*img.Stride:y*img.Stride+len(row)], row)
+	}
+}
+
+// fillRect fills a rectangle, clipped to the frame, with a gray level.
+func (s *testPatternSource) fillRect(x0 int, y0 int, x1 int, y1 int, level uint8) {
+	r := image.Rect(x0, y0, x1, y1).Intersect(s.img.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			i := s.img.PixOffset(x, y)
+			s.img.Pix[i] = level
+			s.img.Pix[i+1] = level
+			s.img.Pix[i+2] = level
+			s.img.Pix[i+3] = 0xFF
+		}
+	}
+}
+
+// drawNumber writes n in white on a black box at x, y with font pixels of
+// scale by scale.
+func (s *testPatternSource) drawNumber(n uint32, x int, y int, scale int) {
+	digits := strconv.FormatUint(uint64(n), 10)
+	// 3 pixels per digit, 1 pixel between digits, 1 pixel of border
+	s.fillRect(x, y, x+(len(digits)*4+1)*scale, y+7*scale, 0x00)
+	for i, d := range digits {
+		glyph := digitFont[d-'0']
+		gx := x + (1+i*4)*scale
+		for row, bits := range glyph {
+			for col := 0; col < 3; col++ {
+				if bits&(1<<(2-col)) == 0 {
+					continue
+				}
+				px := gx + col*scale
+				py := y + (1+row)*scale
+				s.fillRect(px, py, px+scale, py+scale, 0xFF)
+			}
+		}
+	}
+}
+
+// drawBarcode draws the barcode over the bottom of the frame.
+func (s *testPatternSource) drawBarcode(id uint32, now time.Time) {
+	bits := barcodeBits(id, now)
+	cellWidth := s.width / barcodeCells
+	y0 := s.height - barcodeHeight(s.height)
+	for i, bit := range bits {
+		level := uint8(0x00)
+		if bit {
+			level = 0xFF
+		}
+		s.fillRect(i*cellWidth, y0, (i+1)*cellWidth, s.height, level)
+	}
+	// the rest of the last row of cells
+	s.fillRect(barcodeCells*cellWidth, y0, s.width, s.height, 0x00)
+}
+
+func barcodeHeight(height int) int {
+	return max(height/10, 8)
+}
+
+func barcodeBits(id uint32, now time.Time) []bool {
+	payload := make([]byte, 12)
+	binary.BigEndian.PutUint32(payload, id)
+	binary.BigEndian.PutUint64(payload[4:], uint64(now.UnixMilli()))
+	bits := make([]bool, 0, barcodeCells)
+	bits = append(bits, true)
+	for _, b := range payload {
+		for i := 7; i >= 0; i-- {
+			bits = append(bits, b&(1<<i) != 0)
+		}
+	}
+	return append(bits, true)
+}
+
+// ReadTestPatternBarcode decodes the frame id and draw time from a decoded
+// test pattern frame of the configured size. ok is false if img carries no
+// barcode.
+func ReadTestPatternBarcode(img image.Image) (id uint32, drawnAt time.Time, ok bool) {
+	bounds := img.Bounds()
+	cellWidth := bounds.Dx() / barcodeCells
+	if cellWidth == 0 {
+		return 0, time.Time{}, false
+	}
+	y := bounds.Max.Y - barcodeHeight(bounds.Dy())/2
+	bits := make([]bool, barcodeCells)
+	for i := range bits {
+		r, g, b, _ := img.At(bounds.Min.X+i*cellWidth+cellWidth/2, y).RGBA()
+		bits[i] = (r+g+b)/3 >= 0x8000
+	}
+	if !bits[0] || !bits[barcodeCells-1] {
+		return 0, time.Time{}, false
+	}
+	var payload uint64
+	for _, bit := range bits[1 : 1+barcodeIDBits] {
+		payload <<= 1
+		if bit {
+			payload |= 1
+		}
+	}
+	id = uint32(payload)
+	var millis uint64
+	for _, bit := range bits[1+barcodeIDBits : barcodeCells-1] {
+		millis <<= 1
+		if bit {
+			millis |= 1
+		}
+	}
+	return id, time.UnixMilli(int64(millis)), true
+}
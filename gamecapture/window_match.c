@@ -1,104 +1,170 @@
 #include "window_match.h"
+#include <X11/Xatom.h>
+#include <X11/extensions/Xrandr.h>
 #include <stdio.h>
 #include <stdlib.h>
 #include <string.h>
 
-void find_window_by_name_recursive(Display *display, Window window,
-                                   const char *search_name,
-                                   WindowMatch *result) {
+static int ignore_error(Display *display, XErrorEvent *event) { return 0; }
+
+Display *open_display(void) {
+  XSetErrorHandler(ignore_error);
+  return XOpenDisplay(getenv("DISPLAY"));
+}
+
+static void collect_windows(Display *display, Window window, Window **windows,
+                            unsigned int *count, unsigned int *capacity) {
   Window root, parent, *children;
   unsigned int nchildren;
-  XWindowAttributes attrs;
-  char *window_name = NULL;
-  XClassHint class_hint;
-  XTextProperty text_prop;
-
-  // If we already found a match, return early
-  if (result->window != None) {
-    return;
-  }
 
-  // Get window attributes
-  if (!XGetWindowAttributes(display, window, &attrs)) {
+  if (!XQueryTree(display, window, &root, &parent, &children, &nchildren)) {
     return;
   }
-
-  // Check window name from XFetchName
-  if (XFetchName(display, window, &window_name)) {
-    if (window_name && strstr(window_name, search_name)) {
-      result->window = window;
-      XFree(window_name);
-      return;
+  for (unsigned int i = 0; i < nchildren; i++) {
+    if (*count == *capacity) {
+      unsigned int grown = *capacity ? *capacity * 2 : 64;
+      Window *w = realloc(*windows, grown * sizeof(Window));
+      if (!w) {
+        break;
+      }
+      *windows = w;
+      *capacity = grown;
     }
-    if (window_name)
-      XFree(window_name);
+    (*windows)[(*count)++] = children[i];
+    collect_windows(display, children[i], windows, count, capacity);
   }
+  if (children)
+    XFree(children);
+}
 
-  // Check WM_NAME property
-  if (XGetWMName(display, window, &text_prop)) {
-    if (text_prop.value && strstr((char *)text_prop.value, search_name)) {
-      result->window = window;
-      XFree(text_prop.value);
-      return;
+Window *list_windows(Display *display, unsigned int *count) {
+  Window *windows = NULL;
+  unsigned int capacity = 0;
+
+  *count = 0;
+  collect_windows(display, DefaultRootWindow(display), &windows, count,
+                  &capacity);
+  return windows;
+}
+
+char *window_title(Display *display, Window window) {
+  Atom net_wm_name = XInternAtom(display, "_NET_WM_NAME", True);
+  Atom utf8_string = XInternAtom(display, "UTF8_STRING", True);
+  Atom type;
+  int format;
+  unsigned long nitems, bytes_after;
+  unsigned char *prop = NULL;
+  char *title = NULL;
+
+  // Prefer the UTF-8 title of EWMH
+  if (net_wm_name != None && utf8_string != None &&
+      XGetWindowProperty(display, window, net_wm_name, 0, 1024, False,
+                         utf8_string, &type, &format, &nitems, &bytes_after,
+                         &prop) == Success &&
+      prop) {
+    if (type == utf8_string && format == 8) {
+      title = strndup((char *)prop, nitems);
+    }
+    XFree(prop);
+    if (title) {
+      return title;
     }
-    if (text_prop.value)
-      XFree(text_prop.value);
   }
 
-  // Check window class
-  if (XGetClassHint(display, window, &class_hint)) {
-    if ((class_hint.res_name && strstr(class_hint.res_name, search_name)) ||
-        (class_hint.res_class && strstr(class_hint.res_class, search_name))) {
-      result->window = window;
-      XFree(class_hint.res_name);
-      XFree(class_hint.res_class);
-      return;
-    }
-    XFree(class_hint.res_name);
-    XFree(class_hint.res_class);
+  char *window_name = NULL;
+  if (XFetchName(display, window, &window_name) && window_name) {
+    title = strdup(window_name);
+    XFree(window_name);
   }
+  return title;
+}
 
-  // Recursively search children
-  if (XQueryTree(display, window, &root, &parent, &children, &nchildren)) {
-    for (unsigned int i = 0; i < nchildren; i++) {
-      find_window_by_name_recursive(display, children[i], search_name, result);
-      if (result->window != None) {
-        XFree(children);
-        return;
-      }
+long window_pid(Display *display, Window window) {
+  Atom net_wm_pid = XInternAtom(display, "_NET_WM_PID", True);
+  Atom type;
+  int format;
+  unsigned long nitems, bytes_after;
+  unsigned char *prop = NULL;
+  long pid = -1;
+
+  if (net_wm_pid == None) {
+    return -1;
+  }
+  if (XGetWindowProperty(display, window, net_wm_pid, 0, 1, False,
+                         XA_CARDINAL, &type, &format, &nitems, &bytes_after,
+                         &prop) == Success &&
+      prop) {
+    // 32 bit properties are returned as longs
+    if (type == XA_CARDINAL && format == 32 && nitems == 1) {
+      pid = *(long *)prop;
     }
-    if (children)
-      XFree(children);
+    XFree(prop);
   }
+  return pid;
 }
 
-WindowMatch *query_window_by_name(const char *window_name) {
+WindowMatch *query_root_window(void) {
   WindowMatch *result = malloc(sizeof(WindowMatch));
   if (!result) {
     printf("windowmatch malloc failed\n");
     return NULL;
   }
 
-  // Initialize result
-  result->display = XOpenDisplay(getenv("DISPLAY"));
-  result->window = None;
-
+  result->display = open_display();
   if (!result->display) {
     free(result);
     printf("XOpenDisplay failed\n");
     return NULL;
   }
+  result->window = DefaultRootWindow(result->display);
 
-  // Get root window and start recursive search
-  Window root = DefaultRootWindow(result->display);
-  find_window_by_name_recursive(result->display, root, window_name, result);
+  return result;
+}
 
-  // If no window found, clean up and return NULL
-  if (result->window == None) {
-    XCloseDisplay(result->display);
-    free(result);
-    return NULL;
+int query_monitor(Display *display, const char *monitor_name, int *x, int *y,
+                  int *width, int *height) {
+  int event_base, error_base, major, minor;
+  if (!XRRQueryExtension(display, &event_base, &error_base) ||
+      !XRRQueryVersion(display, &major, &minor) ||
+      (major == 1 && minor < 5)) {
+    printf("XRandR 1.5 is not supported\n");
+    return 0;
   }
 
-  return result;
+  int nmonitors = 0;
+  XRRMonitorInfo *monitors =
+      XRRGetMonitors(display, DefaultRootWindow(display), True, &nmonitors);
+  if (!monitors) {
+    return 0;
+  }
+
+  int found = -1;
+  for (int i = 0; i < nmonitors && found < 0; i++) {
+    if (monitor_name[0] == '\0') {
+      if (monitors[i].primary) {
+        found = i;
+      }
+      continue;
+    }
+    char *name = XGetAtomName(display, monitors[i].name);
+    if (name) {
+      if (strcmp(name, monitor_name) == 0) {
+        found = i;
+      }
+      XFree(name);
+    }
+  }
+  // without a primary monitor, take the first one
+  if (found < 0 && monitor_name[0] == '\0' && nmonitors > 0) {
+    found = 0;
+  }
+
+  if (found >= 0) {
+    *x = monitors[found].x;
+    *y = monitors[found].y;
+    *width = monitors[found].width;
+    *height = monitors[found].height;
+  }
+  XRRFreeMonitors(monitors);
+  return found >= 0;
 }
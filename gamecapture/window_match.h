@@ -9,6 +9,26 @@ typedef struct {
   Window window;
 } WindowMatch;
 
-WindowMatch *query_window_by_name(const char *window_name);
+// Opens the display with an error handler that ignores errors, instead of
+// exiting like the default one when a captured window is destroyed.
+Display *open_display(void);
+
+// Lists all windows below the root window, parents before their children.
+// The list is freed with free.
+Window *list_windows(Display *display, unsigned int *count);
+
+// Returns the _NET_WM_NAME or WM_NAME of window, freed with free, or NULL.
+char *window_title(Display *display, Window window);
+
+// Returns the _NET_WM_PID of window, or -1.
+long window_pid(Display *display, Window window);
+
+WindowMatch *query_root_window(void);
+
+// Stores the area of the XRandR monitor named monitor_name, or of the primary
+// monitor when monitor_name is empty, in root window coordinates. Returns 0
+// when there is no such monitor.
+int query_monitor(Display *display, const char *monitor_name, int *x, int *y,
+                  int *width, int *height);
 
 #endif
@@ -1,132 +1,186 @@
 package gamecapture
 
 import (
+	"errors"
 	"fmt"
 	"image"
+	"io"
 	"log/slog"
-	"os/exec"
+	"sync"
 	"time"
 
 	"github.com/3DRX/vaporplay/config"
-	"github.com/pion/mediadevices/pkg/driver"
-	"github.com/pion/mediadevices/pkg/frame"
-	"github.com/pion/mediadevices/pkg/io/video"
-	"github.com/pion/mediadevices/pkg/prop"
 )
 
-type screen struct {
-	name   string
-	reader *reader
-	tick   *time.Ticker
-}
+// resizeCheckInterval is how often the window size is checked.
+const resizeCheckInterval = time.Second
 
-const (
-	STEAM_CMD = "steam"
-	STEAM_URL = "steam://rungameid/%s"
-)
+// ErrWindowNotFound is returned when no matching window shows up in time.
+var ErrWindowNotFound = errors.New("game window not found")
 
-func deviceID(name string) string {
-	return fmt.Sprintf("X11Screen_%s", name)
+func init() {
+	RegisterSource("x11", Source{
+		New:          newX11Source,
+		CapturesGame: true,
+	})
 }
 
-// Start the game and block until the game window appears
-func Initialize(gameCfg *config.GameConfig) string {
-	if gameCfg.GameId != "000000" {
-		cmd := exec.Command(STEAM_CMD, fmt.Sprintf(STEAM_URL, gameCfg.GameId))
-		_, err := cmd.Output()
-		if err != nil {
-			panic(err)
-		}
-	} else {
-		slog.Info("no game id specified, skipping game start")
+// x11Source captures a window, the screen or a monitor with the X11 shared
+// memory extension.
+type x11Source struct {
+	// lock keeps Close from freeing the reader while a frame is read
+	lock      sync.Mutex
+	matcher   *windowMatcher
+	area      captureArea
+	window    *windowmatch
+	reader    *reader
+	onResize  func(width int, height int)
+	lastCheck time.Time
+	// lostAt is when the game window was destroyed, zero while it exists
+	lostAt time.Time
+}
+
+// newX11Source blocks until the game window appears or cancel is closed,
+// when it captures the game window.
+func newX11Source(gameCfg *config.GameConfig, cancel <-chan struct{}) (CaptureSource, error) {
+	s := &x11Source{
+		area:     newCaptureArea(gameCfg),
+		onResize: func(int, int) {},
 	}
+	if s.area.mode != "window" {
+		return s, nil
+	}
+	matcher, err := newWindowMatcher(gameCfg)
+	if err != nil {
+		return nil, err
+	}
+	s.matcher = matcher
 	start := time.Now()
 	for {
-		// wait until the game window appears, timeout by 30 seconds
-		wm, err := openWindow(gameCfg.GameWindowName)
-		if err != nil || wm == nil {
-			now := time.Now()
-			if now.Sub(start) > 120*time.Second {
-				panic("failed to find game window")
-			}
-			slog.Info("waiting for game window", "windowname", gameCfg.GameWindowName)
-			time.Sleep(1 * time.Second)
-			continue
-		}
-		defer wm.Close()
-		img, err := getShmImageFromWindowMatch(wm)
+		// wait until the game window appears
+		wm, err := matcher.find()
 		if err != nil {
-			time.Sleep(1 * time.Second)
-			continue
+			slog.Warn("failed to look for game window", "error", err)
+		}
+		if wm != nil {
+			slog.Info("found game window", "match", matcher)
+			s.window = wm
+			return s, nil
 		}
-		// some game have a small loading window, skip it
-		if img.img.height < 720 {
-			time.Sleep(1 * time.Second)
-			continue
+		if time.Since(start) > matcher.timeout {
+			return nil, fmt.Errorf("%w: no %s after %s", ErrWindowNotFound, matcher, matcher.timeout)
+		}
+		slog.Info("waiting for game window", "match", matcher)
+		select {
+		case <-cancel:
+			return nil, ErrCanceled
+		case <-time.After(1 * time.Second):
 		}
-		slog.Info("found game window", "windowname", gameCfg.GameWindowName)
-		break
 	}
-	slog.Info("initializing game capture", "windowname", gameCfg.GameWindowName)
-	labelName := deviceID(gameCfg.GameWindowName)
-	driver.GetManager().Register(
-		&screen{
-			name: gameCfg.GameWindowName,
-		},
-		driver.Info{
-			Label:      labelName,
-			DeviceType: driver.Camera,
-		},
-	)
-	return labelName
 }
 
-func (s *screen) Open() error {
-	r, err := newReader(s.name)
+func (s *x11Source) Open() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	wm := s.window
+	if wm == nil {
+		var err error
+		if wm, err = openRoot(); err != nil {
+			return err
+		}
+	}
+	// the reader owns the window from now on
+	s.window = nil
+	r, err := newReader(wm, s.area)
 	if err != nil {
 		return err
 	}
 	s.reader = r
+	s.lastCheck = time.Now()
 	return nil
 }
 
-func (s *screen) Close() error {
-	s.reader.Close()
-	if s.tick != nil {
-		s.tick.Stop()
+func (s *x11Source) Read(dst *image.RGBA) (*image.RGBA, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.reader == nil {
+		// closed
+		return nil, io.EOF
 	}
-	return nil
+	if time.Since(s.lastCheck) >= resizeCheckInterval {
+		s.lastCheck = time.Now()
+		if err := s.check(); err != nil {
+			return nil, err
+		}
+	}
+	// a destroyed window reads as its last frame
+	return s.reader.Read().ToRGBA(dst), nil
 }
 
-func (s *screen) VideoRecord(p prop.Media) (video.Reader, error) {
-	if p.FrameRate == 0 {
-		p.FrameRate = 10
+// check follows the size of the captured area, and matches the game window
+// again when it was destroyed, like when a game restarts its renderer.
+func (s *x11Source) check() error {
+	if s.lostAt.IsZero() {
+		resized, err := s.reader.refresh()
+		if errors.Is(err, errWindowGone) && s.matcher != nil {
+			slog.Warn("game window is gone, waiting for it to come back", "match", s.matcher)
+			s.lostAt = time.Now()
+		} else {
+			if err != nil {
+				slog.Warn("failed to follow window size", "error", err)
+			}
+			if resized {
+				s.onResize(s.reader.Size())
+			}
+			return nil
+		}
 	}
-	s.tick = time.NewTicker(time.Duration(float32(time.Second) / p.FrameRate))
+	wm, err := s.matcher.find()
+	if err != nil {
+		slog.Warn("failed to look for game window", "error", err)
+	}
+	if wm != nil {
+		r, err := newReader(wm, s.area)
+		if err == nil {
+			width, height := s.reader.Size()
+			s.reader.Close()
+			s.reader = r
+			s.lostAt = time.Time{}
+			slog.Info("found game window again", "match", s.matcher)
+			if w, h := r.Size(); w != width || h != height {
+				s.onResize(w, h)
+			}
+			return nil
+		}
+		slog.Warn("failed to capture game window", "error", err)
+	}
+	if time.Since(s.lostAt) > s.matcher.timeout {
+		return fmt.Errorf("%w: no %s for %s after the window was destroyed", ErrWindowNotFound, s.matcher, s.matcher.timeout)
+	}
+	return nil
+}
 
-	var dst image.RGBA
-	reader := s.reader
+func (s *x11Source) Size() (int, int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.reader.Size()
+}
 
-	r := video.ReaderFunc(func() (image.Image, func(), error) {
-		<-s.tick.C
-		img := reader.Read().ToRGBA(&dst)
-		return img, func() {}, nil
-	})
-	return r, nil
+func (s *x11Source) OnResize(f func(width int, height int)) {
+	s.onResize = f
 }
 
-func (s *screen) Properties() []prop.Media {
-	rect := s.reader.img.Bounds()
-	w := rect.Dx()
-	h := rect.Dy()
-	return []prop.Media{
-		{
-			DeviceID: deviceID(s.name),
-			Video: prop.Video{
-				Width:       w,
-				Height:      h,
-				FrameFormat: frame.FormatRGBA,
-			},
-		},
+func (s *x11Source) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// the source may be closed before it was opened, or twice
+	if s.window != nil {
+		s.window.Close()
+		s.window = nil
 	}
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+	return nil
 }
@@ -26,14 +26,23 @@ type FecInterceptor struct {
 	mu        sync.Mutex
 }
 
-var instance *FecInterceptor
-
 // FecOption can be used to set initial options on Fec encoder interceptors.
 type FecOption func(d *FecInterceptor) error
 
+// NewFecInterceptorCallback returns the FecInterceptor for the PeerConnection
+// with id.
+type NewFecInterceptorCallback func(id string, fec *FecInterceptor)
+
 // FecInterceptorFactory creates new FecInterceptors.
 type FecInterceptorFactory struct {
-	opts []FecOption
+	opts   []FecOption
+	addFec NewFecInterceptorCallback
+}
+
+// OnNewFecInterceptor sets a callback that is called when a new FecInterceptor
+// is created.
+func (r *FecInterceptorFactory) OnNewFecInterceptor(cb NewFecInterceptorCallback) {
+	r.addFec = cb
 }
 
 // NewFecInterceptor returns a new Fec interceptor factory.
@@ -42,13 +51,15 @@ func NewFecInterceptor(opts ...FecOption) (*FecInterceptorFactory, error) {
 }
 
 // NewInterceptor constructs a new FecInterceptor.
-func (r *FecInterceptorFactory) NewInterceptor(_ string) (interceptor.Interceptor, error) {
+func (r *FecInterceptorFactory) NewInterceptor(id string) (interceptor.Interceptor, error) {
 	interceptor := &FecInterceptor{
 		packetBuffer:       make([]rtp.Packet, 0),
 		minNumMediaPackets: 5,
 	}
 
-	instance = interceptor
+	if r.addFec != nil {
+		r.addFec(id, interceptor)
+	}
 
 	return interceptor, nil
 }
@@ -145,10 +156,3 @@ func (r *FecInterceptor) GetFECBitRate() float64 {
 	r.mu.Unlock()
 	return bitrate
 }
-
-func GetFECBitrate() float64 {
-	if instance == nil {
-		return 0
-	}
-	return instance.GetFECBitRate()
-}
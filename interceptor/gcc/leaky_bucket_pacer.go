@@ -55,16 +55,30 @@ type LeakyBucketPacer struct {
 	writerLock   sync.RWMutex
 
 	// for stats tracing
-	statsChan    chan StatsItem
-	iLock        sync.RWMutex
-	ingress      int
-	ingressCount int
+	statsChan       chan StatsItem
+	iLock           sync.RWMutex
+	ingress         int
+	ingressCount    int
+	statsFilePrefix string
+	// closed once the stats file is flushed after Close
+	statsFlushed chan struct{}
 
 	pool *sync.Pool
 }
 
+// LeakyBucketPacerOption configures a LeakyBucketPacer.
+type LeakyBucketPacerOption func(*LeakyBucketPacer)
+
+// LeakyBucketPacerStatsFilePrefix sets the prefix of the stats file, so that
+// pacers of concurrent sessions write to different files.
+func LeakyBucketPacerStatsFilePrefix(prefix string) LeakyBucketPacerOption {
+	return func(p *LeakyBucketPacer) {
+		p.statsFilePrefix = prefix
+	}
+}
+
 // NewLeakyBucketPacer initializes a new LeakyBucketPacer.
-func NewLeakyBucketPacer(initialBitrate int) *LeakyBucketPacer {
+func NewLeakyBucketPacer(initialBitrate int, opts ...LeakyBucketPacerOption) (*LeakyBucketPacer, error) {
 	pacer := &LeakyBucketPacer{
 		log:            logging.NewDefaultLoggerFactory().NewLogger("pacer"),
 		f:              1.5,
@@ -76,6 +90,14 @@ func NewLeakyBucketPacer(initialBitrate int) *LeakyBucketPacer {
 		ssrcToWriter:   map[uint32]interceptor.RTPWriter{},
 		pool:           &sync.Pool{},
 		statsChan:      make(chan StatsItem, 10),
+		statsFlushed:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(pacer)
+	}
+	f, err := os.Create(pacer.statsFilePrefix + "leaky_bucket_pacer.csv")
+	if err != nil {
+		return nil, err
 	}
 	pacer.pool = &sync.Pool{
 		New: func() interface{} {
@@ -87,9 +109,9 @@ func NewLeakyBucketPacer(initialBitrate int) *LeakyBucketPacer {
 
 	go pacer.Run()
 
-	go PacerStatsThread(pacer.statsChan)
+	go PacerStatsThread(f, pacer.statsChan, pacer.done, pacer.statsFlushed)
 
-	return pacer
+	return pacer, nil
 }
 
 // AddStream adds a new stream and its corresponding writer to the pacer.
@@ -224,46 +246,47 @@ func (p *LeakyBucketPacer) Run() {
 					targetBitrate: p.getTargetBitrate(),
 					bufferCount:   bufferCount,
 				}
-				p.statsChan <- statsItem
+				select {
+				case p.statsChan <- statsItem:
+				case <-p.done:
+					return
+				}
 			}
 		}
 	}
 }
 
-// Close closes the LeakyBucketPacer.
+// Close closes the LeakyBucketPacer and flushes the stats file.
 func (p *LeakyBucketPacer) Close() error {
 	close(p.done)
+	<-p.statsFlushed
 
 	return nil
 }
 
-func PacerStatsThread(statsChan chan StatsItem) {
-	// open file for writing
-	f, err := os.Create("leaky_bucket_pacer.csv")
-	if err != nil {
-		panic(err)
-	}
+// PacerStatsThread writes the pacer stats to f until done is closed, then
+// writes what is still queued, flushes and closes f and closes flushed.
+func PacerStatsThread(f *os.File, statsChan chan StatsItem, done <-chan struct{}, flushed chan<- struct{}) {
+	defer close(flushed)
 	w := bufio.NewWriter(f)
 	w.WriteString("budget,egress,egress_count,ingress,ingress_count,target_bitrate,buffer_count\n")
 	defer f.Close()
+	defer w.Flush()
 	index := 0
 	var statsItem StatsItem
 	for {
 		select {
-		case statsItem = <-statsChan:
-			_, err := w.WriteString(fmt.Sprintf(
-				"%d,%d,%d,%d,%d,%d,%d\n",
-				statsItem.budget,
-				statsItem.egress,
-				statsItem.egressCount,
-				statsItem.ingress,
-				statsItem.ingressCount,
-				statsItem.targetBitrate,
-				statsItem.bufferCount,
-			))
-			if err != nil {
-				slog.Error("failed to write pacer stats to file", "error", err)
+		case <-done:
+			for {
+				select {
+				case statsItem = <-statsChan:
+					writePacerStats(w, statsItem)
+				default:
+					return
+				}
 			}
+		case statsItem = <-statsChan:
+			writePacerStats(w, statsItem)
 			if index%200 == 0 {
 				w.Flush()
 			}
@@ -271,3 +294,19 @@ func PacerStatsThread(statsChan chan StatsItem) {
 		}
 	}
 }
+
+func writePacerStats(w *bufio.Writer, statsItem StatsItem) {
+	_, err := w.WriteString(fmt.Sprintf(
+		"%d,%d,%d,%d,%d,%d,%d\n",
+		statsItem.budget,
+		statsItem.egress,
+		statsItem.egressCount,
+		statsItem.ingress,
+		statsItem.ingressCount,
+		statsItem.targetBitrate,
+		statsItem.bufferCount,
+	))
+	if err != nil {
+		slog.Error("failed to write pacer stats to file", "error", err)
+	}
+}
@@ -73,6 +73,9 @@ type SendSideBWE struct {
 	statsChan       chan CCStats
 	rfc8888Chan     chan []cc.Acknowledgment
 	latestStatsChan chan Stats
+	statsFilePrefix string
+	// closed once the stats files are flushed after Close
+	statsFlushed chan struct{}
 }
 
 // Option configures a bandwidth estimator.
@@ -114,6 +117,16 @@ func SendSideBWEPacer(p Pacer) Option {
 	}
 }
 
+// SendSideBWEStatsFilePrefix sets the prefix of the stats files, so that
+// estimators of concurrent sessions write to different files.
+func SendSideBWEStatsFilePrefix(prefix string) Option {
+	return func(e *SendSideBWE) error {
+		e.statsFilePrefix = prefix
+
+		return nil
+	}
+}
+
 // NewSendSideBWE creates a new sender side bandwidth estimator.
 func NewSendSideBWE(opts ...Option) (*SendSideBWE, error) {
 	statsChan := make(chan CCStats, 100)
@@ -131,6 +144,7 @@ func NewSendSideBWE(opts ...Option) (*SendSideBWE, error) {
 		minBitrate:            minBitrate,
 		maxBitrate:            maxBitrate,
 		close:                 make(chan struct{}),
+		statsFlushed:          make(chan struct{}),
 		statsChan:             statsChan,
 		rfc8888Chan:           rfc8888Chan,
 		latestStatsChan:       latestStatsChan,
@@ -140,8 +154,18 @@ func NewSendSideBWE(opts ...Option) (*SendSideBWE, error) {
 			return nil, err
 		}
 	}
+	f, f2, err := createStatsFiles(send.statsFilePrefix)
+	if err != nil {
+		return nil, err
+	}
 	if send.pacer == nil {
-		send.pacer = NewLeakyBucketPacer(send.latestBitrate)
+		pacer, err := NewLeakyBucketPacer(send.latestBitrate, LeakyBucketPacerStatsFilePrefix(send.statsFilePrefix))
+		if err != nil {
+			f.Close()
+			f2.Close()
+			return nil, err
+		}
+		send.pacer = pacer
 	}
 	send.lossController = newLossBasedBWE(send.latestBitrate)
 	send.delayController = newDelayController(delayControllerConfig{
@@ -153,7 +177,7 @@ func NewSendSideBWE(opts ...Option) (*SendSideBWE, error) {
 
 	send.delayController.onUpdate(send.onDelayUpdate)
 
-	go StatsThread(statsChan, rfc8888Chan, latestStatsChan)
+	go StatsThread(f, f2, statsChan, rfc8888Chan, latestStatsChan, send.close, send.statsFlushed)
 
 	return send, nil
 }
@@ -295,7 +319,8 @@ func (e *SendSideBWE) isClosed() bool {
 	}
 }
 
-// Close stops and closes the bandwidth estimator.
+// Close stops and closes the bandwidth estimator, and flushes the stats
+// files.
 func (e *SendSideBWE) Close() error {
 	e.closeLock.Lock()
 	defer e.closeLock.Unlock()
@@ -304,6 +329,7 @@ func (e *SendSideBWE) Close() error {
 		return err
 	}
 	close(e.close)
+	<-e.statsFlushed
 
 	return e.pacer.Close()
 }
@@ -334,83 +360,139 @@ func (e *SendSideBWE) onDelayUpdate(delayStats DelayStats) {
 		LossStats:  lossStats,
 		DelayStats: delayStats,
 	}
-	e.latestStatsChan <- e.latestStats
+	select {
+	case e.latestStatsChan <- e.latestStats:
+	case <-e.close:
+	}
 }
 
 ////// stats only
 
-func StatsThread(statsChan chan CCStats, rfc8888Chan chan []cc.Acknowledgment, gccStatsChan chan Stats) {
-	f, err := os.Create("gcc_stats.csv")
+// createStatsFiles creates <prefix>gcc_stats.csv and <prefix>rfc8888.csv.
+func createStatsFiles(prefix string) (*os.File, *os.File, error) {
+	f, err := os.Create(prefix + "gcc_stats.csv")
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
+	f2, err := os.Create(prefix + "rfc8888.csv")
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, f2, nil
+}
+
+// StatsThread writes the congestion controller stats to f and f2 until done
+// is closed, then writes what is still queued, flushes and closes both files
+// and closes flushed.
+func StatsThread(
+	f *os.File,
+	f2 *os.File,
+	statsChan chan CCStats,
+	rfc8888Chan chan []cc.Acknowledgment,
+	gccStatsChan chan Stats,
+	done <-chan struct{},
+	flushed chan<- struct{},
+) {
+	defer close(flushed)
 	w := bufio.NewWriter(f)
 	w.WriteString("twcc_id,frame_size,loss_packets_counts,threshold,delay_grad_before_kalman,delay_grad_after_kalman,gcc_bw,rtt\n")
 	defer f.Close()
-	f2, err := os.Create("rfc8888.csv")
-	if err != nil {
-		panic(err)
-	}
 	w2 := bufio.NewWriter(f2)
 	w2.WriteString("sequence_number,ssrc,size,departure,arrival,ecn\n")
 	defer f2.Close()
 	index := 0
 	index2 := 0
+	writeStats := func(statsItem CCStats, gccStats Stats) {
+		acks := statsItem.acks
+		rtt := statsItem.rtt
+		delayGradBeforeKalman := gccStats.DelayStats.Measurement.Microseconds()
+		delayGradAfterKalman := gccStats.DelayStats.Estimate.Microseconds()
+		threshold := gccStats.DelayStats.Threshold.Microseconds()
+		gccBw := minInt(gccStats.DelayStats.TargetBitrate, gccStats.LossStats.TargetBitrate)
+		for _, frame := range groupByFrame(acks) {
+			frameSize := len(frame)
+			lossPacketsCount := getLossPacketsCounts(frame)
+			_, err := w.WriteString(
+				fmt.Sprintf(
+					"%d,%d,%d,%d,%d,%d,%d,%d\n",
+					index,
+					frameSize,
+					lossPacketsCount,
+					threshold,
+					delayGradBeforeKalman,
+					delayGradAfterKalman,
+					gccBw,
+					rtt.Milliseconds(),
+				),
+			)
+			if err != nil {
+				slog.Error("failed to transport packets feedback to file", "error", err)
+			}
+		}
+		if index%20 == 0 {
+			w.Flush()
+		}
+		index++
+	}
+	writeRFC8888 := func(statsItem []cc.Acknowledgment) {
+		for _, p := range statsItem {
+			_, err := w2.WriteString(
+				fmt.Sprintf(
+					"%d,%d,%d,%d,%d,%d\n",
+					p.SequenceNumber,
+					p.SSRC,
+					p.Size,
+					int64(float64(p.Departure.UnixMilli())),
+					int64(float64(p.Arrival.UnixMilli())),
+					p.ECN,
+				),
+			)
+			if err != nil {
+				slog.Error("failed to transport packets feedback to file", "error", err)
+			}
+		}
+		if index2%270 == 0 {
+			w2.Flush()
+		}
+		index2++
+	}
 	for {
 		select {
 		case statsItem := <-statsChan:
-			acks := statsItem.acks
-			rtt := statsItem.rtt
-			gccStats := <-gccStatsChan
-			delayGradBeforeKalman := gccStats.DelayStats.Measurement.Microseconds()
-			delayGradAfterKalman := gccStats.DelayStats.Estimate.Microseconds()
-			threshold := gccStats.DelayStats.Threshold.Microseconds()
-			gccBw := minInt(gccStats.DelayStats.TargetBitrate, gccStats.LossStats.TargetBitrate)
-			for _, frame := range groupByFrame(acks) {
-				frameSize := len(frame)
-				lossPacketsCount := getLossPacketsCounts(frame)
-				_, err := w.WriteString(
-					fmt.Sprintf(
-						"%d,%d,%d,%d,%d,%d,%d,%d\n",
-						index,
-						frameSize,
-						lossPacketsCount,
-						threshold,
-						delayGradBeforeKalman,
-						delayGradAfterKalman,
-						gccBw,
-						rtt.Milliseconds(),
-					),
-				)
-				if err != nil {
-					slog.Error("failed to transport packets feedback to file", "error", err)
-				}
+			select {
+			case gccStats := <-gccStatsChan:
+				writeStats(statsItem, gccStats)
+			case <-done:
+				// the delay controller is closed, no more estimates
 			}
-			if index%20 == 0 {
-				w.Flush()
-			}
-			index++
 		case statsItem := <-rfc8888Chan:
-			for _, p := range statsItem {
-				_, err := w2.WriteString(
-					fmt.Sprintf(
-						"%d,%d,%d,%d,%d,%d\n",
-						p.SequenceNumber,
-						p.SSRC,
-						p.Size,
-						int64(float64(p.Departure.UnixMilli())),
-						int64(float64(p.Arrival.UnixMilli())),
-						p.ECN,
-					),
-				)
-				if err != nil {
-					slog.Error("failed to transport packets feedback to file", "error", err)
+			writeRFC8888(statsItem)
+		case <-done:
+			// WriteRTCP doesn't queue stats once the estimator is closed
+			for {
+				select {
+				case statsItem := <-statsChan:
+					select {
+					case gccStats := <-gccStatsChan:
+						writeStats(statsItem, gccStats)
+					default:
+					}
+					continue
+				case statsItem := <-rfc8888Chan:
+					writeRFC8888(statsItem)
+					continue
+				default:
 				}
+				break
+			}
+			if err := w.Flush(); err != nil {
+				slog.Error("failed to flush gcc stats", "error", err)
 			}
-			if index2%270 == 0 {
-				w2.Flush()
+			if err := w2.Flush(); err != nil {
+				slog.Error("failed to flush rfc8888 stats", "error", err)
 			}
-			index2++
+			return
 		}
 	}
 }
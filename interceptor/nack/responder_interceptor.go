@@ -15,13 +15,24 @@ import (
 	"github.com/pion/rtp"
 )
 
+// NewResponderCallback returns the ResponderInterceptor for the
+// PeerConnection with id.
+type NewResponderCallback func(id string, responder *ResponderInterceptor)
+
 // ResponderInterceptorFactory is a interceptor.Factory for a ResponderInterceptor.
 type ResponderInterceptorFactory struct {
-	opts []ResponderOption
+	opts         []ResponderOption
+	addResponder NewResponderCallback
+}
+
+// OnNewResponder sets a callback that is called when a new ResponderInterceptor
+// is created.
+func (r *ResponderInterceptorFactory) OnNewResponder(cb NewResponderCallback) {
+	r.addResponder = cb
 }
 
 // NewInterceptor constructs a new ResponderInterceptor.
-func (r *ResponderInterceptorFactory) NewInterceptor(_ string) (interceptor.Interceptor, error) {
+func (r *ResponderInterceptorFactory) NewInterceptor(id string) (interceptor.Interceptor, error) {
 	responderInterceptor := &ResponderInterceptor{
 		streamsFilter: streamSupportNack,
 		size:          1024,
@@ -43,7 +54,9 @@ func (r *ResponderInterceptorFactory) NewInterceptor(_ string) (interceptor.Inte
 		return nil, err
 	}
 
-	instance = responderInterceptor
+	if r.addResponder != nil {
+		r.addResponder(id, responderInterceptor)
+	}
 
 	return responderInterceptor, nil
 }
@@ -70,11 +83,9 @@ type localStream struct {
 	rtpWriter      interceptor.RTPWriter
 }
 
-var instance *ResponderInterceptor
-
 // NewResponderInterceptor returns a new ResponderInterceptorFactor.
 func NewResponderInterceptor(opts ...ResponderOption) (*ResponderInterceptorFactory, error) {
-	return &ResponderInterceptorFactory{opts}, nil
+	return &ResponderInterceptorFactory{opts: opts}, nil
 }
 
 // BindRTCPReader lets you modify any incoming RTCP packets. It is called once per sender/receiver, however this might
@@ -202,30 +213,42 @@ func (n *ResponderInterceptor) resendPackets(nack *rtcp.TransportLayerNack) {
 	}
 }
 
-// GetNACKBitRate calculates and returns the current NACK bit rate in bits per second.
+// GetNACKBitRate calculates and returns the current NACK bit rate in bits per second,
+// and starts a new measurement.
 func (n *ResponderInterceptor) GetNACKBitRate() float64 {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
-	if n.startTime.IsZero() {
-		return 0
-	}
-
-	duration := time.Since(n.startTime).Seconds()
-	if duration == 0 {
+	bitrate, ok := n.nackBitRate()
+	if !ok {
 		return 0
 	}
-
-	// Convert bytes to bits and calculate the rate
-	bitrate := (float64(n.resendBytes) * 8) / duration
 	n.resendBytes = 0
 	n.startTime = time.Now()
 	return bitrate
 }
 
-func GetNACKBitRate() float64 {
-	if instance == nil {
-		return 0
+// PeekNACKBitRate returns the NACK bit rate in bits per second since the last
+// call of GetNACKBitRate, without starting a new measurement.
+func (n *ResponderInterceptor) PeekNACKBitRate() float64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	bitrate, _ := n.nackBitRate()
+	return bitrate
+}
+
+// nackBitRate returns false when no measurement is running, n.mu must be held.
+func (n *ResponderInterceptor) nackBitRate() (float64, bool) {
+	if n.startTime.IsZero() {
+		return 0, false
 	}
-	return instance.GetNACKBitRate()
+
+	duration := time.Since(n.startTime).Seconds()
+	if duration == 0 {
+		return 0, false
+	}
+
+	// Convert bytes to bits and calculate the rate
+	return (float64(n.resendBytes) * 8) / duration, true
 }
@@ -0,0 +1,214 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/3DRX/vaporplay/config"
+	"github.com/3DRX/vaporplay/pairing"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SessionCookieName is the cookie that carries a web UI login.
+const SessionCookieName = "vaporplay_session"
+
+// Authenticator checks the credentials of requests. Native clients send a
+// static token or their pairing key as "Authorization: Bearer <token>",
+// the web UI logs in with a username and password or a token and gets a
+// session cookie.
+type Authenticator struct {
+	cfg           atomic.Pointer[config.AuthConfig]
+	pairedClients *pairing.Store
+	sessions      map[string]time.Time
+	lock          sync.Mutex
+}
+
+func NewAuthenticator(cfg *config.AuthConfig, pairedClients *pairing.Store) *Authenticator {
+	if !cfg.Enabled() {
+		slog.Warn("no tokens, users or pairing configured, authentication is disabled")
+	}
+	a := &Authenticator{
+		pairedClients: pairedClients,
+		sessions:      map[string]time.Time{},
+	}
+	a.cfg.Store(cfg)
+	return a
+}
+
+// SetConfig replaces the auth config, login sessions stay valid.
+func (a *Authenticator) SetConfig(cfg *config.AuthConfig) {
+	a.cfg.Store(cfg)
+}
+
+func (a *Authenticator) Enabled() bool {
+	return a.cfg.Load().Enabled()
+}
+
+// CheckToken reports whether token is one of the configured static tokens.
+func (a *Authenticator) CheckToken(token string) bool {
+	digest := sha256.Sum256([]byte(token))
+	tokenHash := hex.EncodeToString(digest[:])
+	ok := false
+	for _, h := range a.cfg.Load().TokenHashes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(tokenHash)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// CheckPassword reports whether the username and password match a
+// configured user.
+func (a *Authenticator) CheckPassword(username string, password string) bool {
+	for _, user := range a.cfg.Load().Users {
+		if user.Username != username {
+			continue
+		}
+		return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+	}
+	return false
+}
+
+// NewSession starts a login session and returns its token.
+func (a *Authenticator) NewSession() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	now := time.Now()
+	for t, expiry := range a.sessions {
+		if now.After(expiry) {
+			delete(a.sessions, t)
+		}
+	}
+	a.sessions[token] = now.Add(time.Duration(a.cfg.Load().SessionTTL) * time.Second)
+	return token, nil
+}
+
+func (a *Authenticator) checkPairedClient(key string) bool {
+	return a.cfg.Load().Pairing && a.pairedClients.CheckKey(key)
+}
+
+func (a *Authenticator) checkSession(token string) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	expiry, ok := a.sessions[token]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expiry) {
+		delete(a.sessions, token)
+		return false
+	}
+	return true
+}
+
+// EndSession logs out the session of the request, if any.
+func (a *Authenticator) EndSession(r *http.Request) {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.sessions, cookie.Value)
+}
+
+// Authenticate reports whether the request carries a valid bearer token or
+// session cookie. Every request is authenticated when auth is disabled.
+func (a *Authenticator) Authenticate(r *http.Request) bool {
+	if !a.Enabled() {
+		return true
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return a.CheckToken(token) || a.checkSession(token) || a.checkPairedClient(token)
+	}
+	if cookie, err := r.Cookie(SessionCookieName); err == nil {
+		return a.checkSession(cookie.Value)
+	}
+	return false
+}
+
+// AuthenticateOperator reports whether the request comes from an operator,
+// who logged in or has a static token. Paired clients may only play.
+func (a *Authenticator) AuthenticateOperator(r *http.Request) bool {
+	if !a.Enabled() {
+		return true
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return a.CheckToken(token) || a.checkSession(token)
+	}
+	if cookie, err := r.Cookie(SessionCookieName); err == nil {
+		return a.checkSession(cookie.Value)
+	}
+	return false
+}
+
+// SetSessionCookie makes the browser send token with every request.
+func (a *Authenticator) SetSessionCookie(w http.ResponseWriter, r *http.Request, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   a.cfg.Load().SessionTTL,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (a *Authenticator) ClearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+}
+
+// AuthMiddleware rejects requests that aren't authenticated.
+func AuthMiddleware(a *Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !a.Authenticate(r) {
+				slog.Warn("Unauthenticated request", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="vaporplay"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// OperatorMiddleware rejects requests that don't come from an operator.
+func OperatorMiddleware(a *Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if a.AuthenticateOperator(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if a.Authenticate(r) {
+				slog.Warn("Request of a client to an operator route", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			slog.Warn("Unauthenticated request", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="vaporplay"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"log/slog"
 	"net/http"
+	"net/url"
 )
 
 type responseWriter struct {
@@ -24,21 +25,71 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func CORSMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		allowedOrigin := "*"
-		allowedMethods := "GET, POST, PUT, DELETE, OPTIONS"
-		allowedHeaders := "Content-Type, Authorization, X-Requested-With"
-		w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
-		w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
-		w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+// OriginAllowed reports whether a request may come from its Origin. Requests
+// without an Origin don't come from a browser, same origin requests are
+// always allowed.
+func OriginAllowed(r *http.Request, allowedOrigins []string) bool {
+	if OriginTrusted(r, allowedOrigins) {
+		return true
+	}
+	for _, allowedOrigin := range allowedOrigins {
+		if allowedOrigin == "*" {
+			return true
 		}
-		next.ServeHTTP(w, r)
-	})
+	}
+	return false
+}
+
+// OriginTrusted reports whether a request may come from its Origin with
+// credentials like the session cookie, "*" in allowedOrigins doesn't trust
+// any origin.
+func OriginTrusted(r *http.Request, allowedOrigins []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && u.Host == r.Host {
+		return true
+	}
+	for _, allowedOrigin := range allowedOrigins {
+		if allowedOrigin == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func CORSMiddleware(allowedOrigins func() []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Origin")
+			origins := allowedOrigins()
+			if !OriginAllowed(r, origins) {
+				slog.Warn("Request from disallowed origin", "origin", r.Header.Get("Origin"), "path", r.URL.Path)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if origin := r.Header.Get("Origin"); origin != "" {
+				allowedMethods := "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+				allowedHeaders := "Content-Type, Authorization, X-Requested-With"
+				if OriginTrusted(r, origins) {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				} else {
+					// origins only allowed by "*" don't get to send the session cookie
+					w.Header().Set("Access-Control-Allow-Origin", "*")
+				}
+				w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+				w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+				w.Header().Set("Access-Control-Expose-Headers", "Location")
+			}
+			if r.Method == "OPTIONS" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
 func ChainMiddleware(handler http.Handler, middlewares ...func(http.Handler) http.Handler) http.Handler {
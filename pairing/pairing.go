@@ -0,0 +1,298 @@
+// Package pairing keeps the list of clients paired with the server.
+//
+// A new client generates a long-lived key and a 4 digit PIN, shows the PIN
+// and sends both to the server, which records a pending pairing request.
+// The operator approves the request by entering the PIN on the server side,
+// from then on the client authenticates with its key. Only a hash of the key
+// is stored.
+//
+// The list is a JSON file next to config.json, shared by the running server
+// and the command line, so every change locks and rewrites the file.
+package pairing
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RequestTimeout is how long a pairing request waits for approval.
+const RequestTimeout = 2 * time.Minute
+
+// maxPendingRequests limits unapproved requests, since anyone can send one.
+const maxPendingRequests = 8
+
+// maxPendingPerAddr limits unapproved requests from one address, so a single
+// caller can't keep other clients from pairing.
+const maxPendingPerAddr = 2
+
+var (
+	ErrUnknownPIN     = errors.New("no pending pairing request with this PIN")
+	ErrUnknownClient  = errors.New("no such client")
+	ErrPINInUse       = errors.New("PIN is used by another pending request")
+	ErrTooManyPending = errors.New("too many pending pairing requests")
+)
+
+type Client struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	KeyHash string `json:"key_hash,omitempty"`
+	// PIN is only set while the request is pending
+	PIN string `json:"pin,omitempty"`
+	// Addr is the address the pending request came from
+	Addr        string     `json:"addr,omitempty"`
+	RequestedAt time.Time  `json:"requested_at"`
+	PairedAt    *time.Time `json:"paired_at,omitempty"`
+}
+
+func (c *Client) Paired() bool {
+	return c.PairedAt != nil
+}
+
+func (c *Client) expired(now time.Time) bool {
+	return !c.Paired() && now.Sub(c.RequestedAt) > RequestTimeout
+}
+
+// StorePath returns the path of the paired client list that belongs to a
+// config file.
+func StorePath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), "paired_clients.json")
+}
+
+// NewKey generates a client key.
+func NewKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// NewPIN generates a 4 digit PIN.
+func NewPIN() (string, error) {
+	b := make([]byte, 2)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%04d", (int(b[0])<<8|int(b[1]))%10000), nil
+}
+
+func hashKey(key string) string {
+	digest := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(digest[:])
+}
+
+type Store struct {
+	path string
+	lock sync.Mutex
+	// cached is the parsed list of the file described by cachedInfo, so
+	// that checking a key doesn't parse the file again
+	cached     []Client
+	cachedInfo os.FileInfo
+}
+
+func NewStore(path string) *Store {
+	return &Store{
+		path: path,
+	}
+}
+
+// update runs f on the client list while holding a lock on the file, and
+// writes the list back if f succeeds.
+func (s *Store) update(f func(clients []Client) ([]Client, error)) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	lockFile, err := os.OpenFile(s.path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer lockFile.Close()
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+
+	clients, err := s.load()
+	if err != nil {
+		return err
+	}
+	clients, err = f(clients)
+	if err != nil {
+		return err
+	}
+	return s.save(clients)
+}
+
+// load reads the client list and drops expired requests. The file is only
+// parsed again when it was replaced or modified since the last load.
+func (s *Store) load() ([]Client, error) {
+	clients, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	valid := make([]Client, 0, len(clients))
+	for _, c := range clients {
+		if !c.expired(now) {
+			valid = append(valid, c)
+		}
+	}
+	return valid, nil
+}
+
+// read returns the cached client list if the file didn't change, the
+// list must not be modified.
+func (s *Store) read() ([]Client, error) {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.cached, s.cachedInfo = nil, nil
+		return []Client{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.cachedInfo != nil && os.SameFile(info, s.cachedInfo) &&
+		info.ModTime().Equal(s.cachedInfo.ModTime()) && info.Size() == s.cachedInfo.Size() {
+		return s.cached, nil
+	}
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	clients := []Client{}
+	if err := json.Unmarshal(b, &clients); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+	s.cached, s.cachedInfo = clients, info
+	return clients, nil
+}
+
+func (s *Store) save(clients []Client) error {
+	b, err := json.MarshalIndent(clients, "", "    ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Request records a pending pairing request for a client at addr.
+func (s *Store) Request(name string, key string, pin string, addr string) (*Client, error) {
+	id, err := NewKey()
+	if err != nil {
+		return nil, err
+	}
+	client := Client{
+		ID:          id[:16],
+		Name:        name,
+		KeyHash:     hashKey(key),
+		PIN:         pin,
+		Addr:        addr,
+		RequestedAt: time.Now(),
+	}
+	err = s.update(func(clients []Client) ([]Client, error) {
+		pending, pendingFromAddr := 0, 0
+		for _, c := range clients {
+			if c.Paired() {
+				continue
+			}
+			pending++
+			if c.Addr == addr {
+				pendingFromAddr++
+			}
+			if c.PIN == pin {
+				return nil, ErrPINInUse
+			}
+		}
+		if pending >= maxPendingRequests || pendingFromAddr >= maxPendingPerAddr {
+			return nil, ErrTooManyPending
+		}
+		return append(clients, client), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// Approve pairs the client whose pending request has the PIN.
+func (s *Store) Approve(pin string) (*Client, error) {
+	var approved *Client
+	err := s.update(func(clients []Client) ([]Client, error) {
+		for i := range clients {
+			if clients[i].Paired() || clients[i].PIN != pin {
+				continue
+			}
+			now := time.Now()
+			clients[i].PairedAt = &now
+			clients[i].PIN = ""
+			clients[i].Addr = ""
+			c := clients[i]
+			approved = &c
+			return clients, nil
+		}
+		return nil, ErrUnknownPIN
+	})
+	return approved, err
+}
+
+// Revoke removes a paired client or a pending request.
+func (s *Store) Revoke(id string) error {
+	return s.update(func(clients []Client) ([]Client, error) {
+		for i := range clients {
+			if clients[i].ID == id {
+				return append(clients[:i], clients[i+1:]...), nil
+			}
+		}
+		return nil, ErrUnknownClient
+	})
+}
+
+// List returns paired clients and pending requests.
+func (s *Store) List() ([]Client, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.load()
+}
+
+// Get returns a paired client or a pending request.
+func (s *Store) Get(id string) (*Client, error) {
+	clients, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range clients {
+		if c.ID == id {
+			return &c, nil
+		}
+	}
+	return nil, ErrUnknownClient
+}
+
+// CheckKey reports whether key belongs to a paired client.
+func (s *Store) CheckKey(key string) bool {
+	clients, err := s.List()
+	if err != nil {
+		return false
+	}
+	keyHash := hashKey(key)
+	ok := false
+	for _, c := range clients {
+		if c.Paired() && subtle.ConstantTimeCompare([]byte(c.KeyHash), []byte(keyHash)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
@@ -0,0 +1,158 @@
+package pairing
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	return NewStore(filepath.Join(t.TempDir(), "paired_clients.json"))
+}
+
+func newTestKey(t *testing.T) string {
+	t.Helper()
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestPairing(t *testing.T) {
+	s := newTestStore(t)
+	key := newTestKey(t)
+	client, err := s.Request("deck", key, "1234", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.CheckKey(key) {
+		t.Error("key of a pending request is accepted")
+	}
+	if _, err := s.Approve("4321"); !errors.Is(err, ErrUnknownPIN) {
+		t.Errorf("approving an unknown PIN: got %v, want %v", err, ErrUnknownPIN)
+	}
+	approved, err := s.Approve("1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approved.ID != client.ID || !approved.Paired() || approved.PIN != "" || approved.Addr != "" {
+		t.Errorf("got approved client %+v", approved)
+	}
+	if !s.CheckKey(key) {
+		t.Error("key of a paired client is rejected")
+	}
+	if s.CheckKey(newTestKey(t)) {
+		t.Error("unknown key is accepted")
+	}
+	// the PIN is free again once its request is approved
+	if _, err := s.Approve("1234"); !errors.Is(err, ErrUnknownPIN) {
+		t.Errorf("approving a PIN twice: got %v, want %v", err, ErrUnknownPIN)
+	}
+	if err := s.Revoke(client.ID); err != nil {
+		t.Fatal(err)
+	}
+	if s.CheckKey(key) {
+		t.Error("key of a revoked client is accepted")
+	}
+	if err := s.Revoke(client.ID); !errors.Is(err, ErrUnknownClient) {
+		t.Errorf("revoking twice: got %v, want %v", err, ErrUnknownClient)
+	}
+}
+
+func TestDuplicatePIN(t *testing.T) {
+	s := newTestStore(t)
+	if _, err := s.Request("deck", newTestKey(t), "1234", "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Request("laptop", newTestKey(t), "1234", "192.0.2.2"); !errors.Is(err, ErrPINInUse) {
+		t.Errorf("got %v, want %v", err, ErrPINInUse)
+	}
+}
+
+func TestPendingLimits(t *testing.T) {
+	s := newTestStore(t)
+	for i := 0; i < maxPendingPerAddr; i++ {
+		if _, err := s.Request("deck", newTestKey(t), fmt.Sprintf("%04d", i), "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Request("deck", newTestKey(t), "9999", "192.0.2.1"); !errors.Is(err, ErrTooManyPending) {
+		t.Errorf("request above the limit of an address: got %v, want %v", err, ErrTooManyPending)
+	}
+	for i := maxPendingPerAddr; i < maxPendingRequests; i++ {
+		if _, err := s.Request("deck", newTestKey(t), fmt.Sprintf("%04d", i), fmt.Sprintf("192.0.2.%d", 100+i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Request("deck", newTestKey(t), "9999", "198.51.100.1"); !errors.Is(err, ErrTooManyPending) {
+		t.Errorf("request above the limit: got %v, want %v", err, ErrTooManyPending)
+	}
+	// paired clients don't count
+	if _, err := s.Approve("0000"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Request("deck", newTestKey(t), "9999", "192.0.2.1"); err != nil {
+		t.Errorf("request after approving one: %v", err)
+	}
+}
+
+func TestExpiredRequests(t *testing.T) {
+	s := newTestStore(t)
+	key := newTestKey(t)
+	if _, err := s.Request("deck", key, "1234", "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	err := s.update(func(clients []Client) ([]Client, error) {
+		for i := range clients {
+			clients[i].RequestedAt = time.Now().Add(-RequestTimeout - time.Second)
+		}
+		return clients, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clients) != 0 {
+		t.Errorf("got clients %+v, want the expired request to be gone", clients)
+	}
+	if _, err := s.Approve("1234"); !errors.Is(err, ErrUnknownPIN) {
+		t.Errorf("approving an expired request: got %v, want %v", err, ErrUnknownPIN)
+	}
+	if _, err := s.Request("deck", key, "1234", "192.0.2.1"); err != nil {
+		t.Errorf("PIN of an expired request: %v", err)
+	}
+}
+
+// TestSharedFile changes the list with another store, like the command line
+// does while the server runs.
+func TestSharedFile(t *testing.T) {
+	s := newTestStore(t)
+	cli := NewStore(s.path)
+	key := newTestKey(t)
+	client, err := s.Request("deck", key, "1234", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.CheckKey(key) {
+		t.Error("key of a pending request is accepted")
+	}
+	if _, err := cli.Approve("1234"); err != nil {
+		t.Fatal(err)
+	}
+	if !s.CheckKey(key) {
+		t.Error("key approved by another store is rejected")
+	}
+	if err := cli.Revoke(client.ID); err != nil {
+		t.Fatal(err)
+	}
+	if s.CheckKey(key) {
+		t.Error("key revoked by another store is accepted")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// printPasswordHash reads a password from stdin and prints the hash to put
+// into auth.users.
+func printPasswordHash() error {
+	fmt.Fprint(os.Stderr, "password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		return fmt.Errorf("empty password")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(hash))
+	return nil
+}
+
+// printNewToken prints a random bearer token for a client and the hash to
+// put into auth.token_hashes.
+func printNewToken() error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(b)
+	digest := sha256.Sum256([]byte(token))
+	fmt.Println("token:", token)
+	fmt.Println("hash: ", hex.EncodeToString(digest[:]))
+	return nil
+}
@@ -11,7 +11,9 @@ require (
 	github.com/pion/interceptor v0.1.37
 	github.com/pion/mediadevices v0.7.2-0.20250411040501-20e8c5073579
 	github.com/pion/sdp/v3 v3.0.11
+	github.com/pion/turn/v4 v4.0.0
 	github.com/pion/webrtc/v4 v4.0.15
+	golang.org/x/crypto v0.36.0
 )
 
 require (
@@ -29,9 +31,7 @@ require (
 	github.com/pion/srtp/v3 v3.0.4 // indirect
 	github.com/pion/stun/v3 v3.0.0 // indirect
 	github.com/pion/transport/v3 v3.0.7 // indirect
-	github.com/pion/turn/v4 v4.0.0 // indirect
 	github.com/wlynxg/anet v0.0.5 // indirect
-	golang.org/x/crypto v0.36.0 // indirect
 	golang.org/x/image v0.23.0 // indirect
 	golang.org/x/net v0.38.0 // indirect
 	golang.org/x/sys v0.31.0 // indirect
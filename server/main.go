@@ -1,16 +1,25 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"io/fs"
 	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/3DRX/vaporplay/config"
-	"github.com/3DRX/vaporplay/server/peerconnection"
+	"github.com/3DRX/vaporplay/pairing"
+	"github.com/3DRX/vaporplay/server/session"
 	"github.com/3DRX/vaporplay/server/signaling"
-	"github.com/pion/webrtc/v4"
+	"github.com/3DRX/vaporplay/server/tlscert"
+	"github.com/3DRX/vaporplay/server/turnserver"
 )
 
 //go:embed webui/*
@@ -18,52 +27,162 @@ var embedFS embed.FS
 
 var cpuProfile = flag.String("cpuprofile", "", "write cpu profile to file")
 var configPath = flag.String("config", "", "path to config file")
+var hashPassword = flag.Bool("hash-password", false, "read a password from stdin, print its hash for auth.users and exit")
+var newToken = flag.Bool("new-token", false, "print a new client token and its hash for auth.token_hashes and exit")
+var pairList = flag.Bool("pair-list", false, "list paired clients and pending pairing requests and exit")
+var pairApprove = flag.String("pair-approve", "", "approve the pending pairing request with this PIN and exit")
+var pairRevoke = flag.String("pair-revoke", "", "revoke the paired client with this id and exit")
+var importSteam = flag.Bool("import-steam", false, "add the games of the local steam library to the config file and exit")
+var steamRoot = flag.String("steam-root", "", "steam installation to import games from, defaults to the one in the home directory")
+var printConfig = flag.Bool("print-config", false, "print the resolved config with secrets redacted and exit")
+
+// overrides take precedence over VAPORPLAY_* environment variables, which
+// take precedence over the config file
+var overrides = config.Overrides{}
+
+func init() {
+	flag.Var(overrides, "set", "override a config value, path=value like default_codec.codec=libx264, can be repeated")
+}
 
 func main() {
-	flag.Parse()
+	// "vaporplay validate -config=..." only checks the config
+	validate := len(os.Args) > 1 && os.Args[1] == "validate"
+	if validate {
+		flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
+	}
+	if *hashPassword {
+		if err := printPasswordHash(); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if *newToken {
+		if err := printNewToken(); err != nil {
+			panic(err)
+		}
+		return
+	}
 	if *configPath == "" {
 		panic("config file path is required")
 	}
-	cfg := config.LoadCfg(*configPath)
-	sendSDPChan := make(chan webrtc.SessionDescription)
-	recvSDPChan := make(chan webrtc.SessionDescription)
-	sendCandidateChan := make(chan webrtc.ICECandidateInit)
-	recvCandidateChan := make(chan webrtc.ICECandidateInit)
-	endWsPromise := make(chan struct{})
+	if validate {
+		if err := validateConfig(*configPath); err != nil {
+			printConfigError(*configPath, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s is valid\n", *configPath)
+		return
+	}
+	if ok, err := runPairingCommand(*configPath); ok {
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+	cfg, err := config.LoadCfg(*configPath, overrides)
+	if err != nil {
+		printConfigError(*configPath, err)
+		os.Exit(1)
+	}
+	if *printConfig {
+		b, err := json.MarshalIndent(cfg.Redacted(), "", "    ")
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(string(b))
+		return
+	}
+	games := config.NewGameCatalog(*configPath, cfg.Games)
+	if *importSteam || cfg.SteamImport.Enabled {
+		root := *steamRoot
+		if root == "" {
+			root = cfg.SteamImport.Root
+		}
+		added, err := importSteamGames(games, root)
+		switch {
+		case err != nil && *importSteam:
+			panic(err)
+		case err != nil:
+			// the server is still useful without the steam games
+			slog.Error("failed to import steam library, skipping it", "error", err)
+		default:
+			slog.Info("steam library imported", "new games", len(added))
+		}
+		if *importSteam {
+			return
+		}
+	}
+
+	if cfg.TLS.Enabled {
+		fingerprint, err := tlscert.Prepare(cfg)
+		if err != nil {
+			panic(err)
+		}
+		slog.Info("serving https", "cert", cfg.TLS.CertFile, "sha256 fingerprint", fingerprint)
+	}
 
 	subFS, err := fs.Sub(embedFS, "webui")
 	if err != nil {
 		panic(err)
 	}
 
+	var turnServer *turnserver.TURNServer
+	if cfg.TURN.Enabled {
+		turnServer, err = turnserver.NewTURNServer(cfg)
+		if err != nil {
+			panic(err)
+		}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	reloader := config.NewReloader(*configPath, overrides, cfg)
+	go reloader.Watch(ctx.Done())
+	sessionManager := session.NewManager(reloader, *cpuProfile, turnServer)
+
 	signalingThread := signaling.NewSignalingThread(
-		cfg,
-		sendSDPChan,
-		recvSDPChan,
-		sendCandidateChan,
-		recvCandidateChan,
+		reloader,
+		games,
 		http.FS(subFS),
-		endWsPromise,
+		pairing.NewStore(pairing.StorePath(*configPath)),
+		sessionManager,
 	)
 	haveReceiverPromise := signalingThread.Spin()
-	sessionConfig := <-haveReceiverPromise
 
-	peerConnectionThread := peerconnection.NewPeerConnectionThread(
-		sendSDPChan,
-		recvSDPChan,
-		sendCandidateChan,
-		recvCandidateChan,
-		cfg,
-		sessionConfig,
-		*cpuProfile,
-		endWsPromise,
-	)
-	peerConnectionThread.Spin()
+	go sessionManager.Spin(haveReceiverPromise)
+	<-ctx.Done()
+	// a second signal kills the server right away
+	stop()
+	if err := shutdown(reloader.Config(), sessionManager, signalingThread, turnServer); err != nil {
+		slog.Error("shutdown did not finish in time", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("server stopped")
+}
 
-	// cleaning
-	if err := signalingThread.Close(); err != nil {
-		slog.Error("failed to close signaling thread", "error", err)
-		panic(err)
+// shutdown ends the running sessions, which says bye to their clients and
+// cleans up after them, then stops serving, all within cfg.ShutdownTimeout.
+func shutdown(
+	cfg *config.Config,
+	sessionManager *session.Manager,
+	signalingThread *signaling.SignalingThread,
+	turnServer *turnserver.TURNServer,
+) error {
+	timeout := time.Duration(cfg.ShutdownTimeout) * time.Second
+	slog.Info("shutting down", "timeout", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := sessionManager.Shutdown(ctx); err != nil {
+		return err
+	}
+	if err := signalingThread.Shutdown(ctx); err != nil {
+		return err
+	}
+	if turnServer != nil {
+		if err := turnServer.Close(); err != nil {
+			slog.Warn("failed to close TURN server", "error", err)
+		}
 	}
-	slog.Info("signaling thread closed")
+	return nil
 }
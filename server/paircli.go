@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/3DRX/vaporplay/pairing"
+)
+
+// runPairingCommand lists, approves or revokes paired clients of the server
+// whose config is at configPath. It returns false if no pairing flag is set.
+func runPairingCommand(configPath string) (bool, error) {
+	if !*pairList && *pairApprove == "" && *pairRevoke == "" {
+		return false, nil
+	}
+	store := pairing.NewStore(pairing.StorePath(configPath))
+	switch {
+	case *pairApprove != "":
+		client, err := store.Approve(*pairApprove)
+		if err != nil {
+			return true, err
+		}
+		fmt.Printf("paired %s (%s)\n", client.Name, client.ID)
+	case *pairRevoke != "":
+		if err := store.Revoke(*pairRevoke); err != nil {
+			return true, err
+		}
+		fmt.Printf("revoked %s\n", *pairRevoke)
+	default:
+		clients, err := store.List()
+		if err != nil {
+			return true, err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tSTATE\tSINCE")
+		for _, c := range clients {
+			if c.Paired() {
+				fmt.Fprintf(w, "%s\t%s\tpaired\t%s\n", c.ID, c.Name, c.PairedAt.Format(time.DateTime))
+			} else {
+				fmt.Fprintf(w, "%s\t%s\tpending\t%s\n", c.ID, c.Name, c.RequestedAt.Format(time.DateTime))
+			}
+		}
+		w.Flush()
+	}
+	return true, nil
+}
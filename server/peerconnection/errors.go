@@ -0,0 +1,69 @@
+package peerconnection
+
+import (
+	"errors"
+
+	"github.com/3DRX/vaporplay/gamecapture"
+)
+
+// Stage is the part of a session that failed.
+type Stage string
+
+const (
+	StageCodec       Stage = "codec"
+	StageWebRTC      Stage = "webrtc"
+	StageCapture     Stage = "capture"
+	StageGamepad     Stage = "gamepad"
+	StageNegotiation Stage = "negotiation"
+	StageCleanup     Stage = "cleanup"
+)
+
+// SessionError is returned by NewPeerConnectionThread and Spin when a
+// session fails. Whatever the session created up to that point is already
+// released.
+type SessionError struct {
+	Stage Stage
+	Err   error
+}
+
+func sessionError(stage Stage, err error) *SessionError {
+	return &SessionError{Stage: stage, Err: err}
+}
+
+func (e *SessionError) Error() string {
+	return string(e.Stage) + ": " + e.Err.Error()
+}
+
+func (e *SessionError) Unwrap() error {
+	return e.Err
+}
+
+// Message describes the failure for the client.
+func (e *SessionError) Message() string {
+	switch {
+	case errors.Is(e.Err, gamecapture.ErrLaunchFailed):
+		return "the game could not be launched"
+	case errors.Is(e.Err, gamecapture.ErrWindowNotFound):
+		return "the game window did not show up"
+	case errors.Is(e.Err, gamecapture.ErrMonitorNotFound):
+		return "the monitor to capture was not found"
+	case errors.Is(e.Err, gamecapture.ErrCanceled):
+		return "the session ended before the game could be captured"
+	case errors.Is(e.Err, gamecapture.ErrUnknownSource):
+		return "the capture source of the game is not available"
+	}
+	switch e.Stage {
+	case StageCodec:
+		return "the encoder could not be set up: " + e.Err.Error()
+	case StageWebRTC:
+		return "the peer connection could not be set up: " + e.Err.Error()
+	case StageCapture:
+		return "the game could not be captured: " + e.Err.Error()
+	case StageGamepad:
+		return "the virtual gamepad could not be created: " + e.Err.Error()
+	case StageNegotiation:
+		return "the connection could not be negotiated: " + e.Err.Error()
+	default:
+		return "the session failed: " + e.Err.Error()
+	}
+}
@@ -2,6 +2,7 @@ package peerconnection
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math"
@@ -9,10 +10,14 @@ import (
 	"os/exec"
 	"runtime/pprof"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/3DRX/vaporplay/codec/ffmpeg"
 	"github.com/3DRX/vaporplay/config"
 	"github.com/3DRX/vaporplay/gamecapture"
+	_ "github.com/3DRX/vaporplay/gamecapture/mediafile" // registers the mediafile capture source
 	"github.com/3DRX/vaporplay/gamepaddto"
 	"github.com/3DRX/vaporplay/interceptor/cc"
 	"github.com/3DRX/vaporplay/interceptor/flexfec"
@@ -20,6 +25,7 @@ import (
 	"github.com/3DRX/vaporplay/interceptor/gcc"
 	"github.com/3DRX/vaporplay/interceptor/nack"
 	"github.com/3DRX/vaporplay/interceptor/twcc"
+	"github.com/3DRX/vaporplay/signalingdto"
 	"github.com/asticode/go-astiav"
 	"github.com/pion/interceptor"
 	"github.com/pion/interceptor/pkg/report"
@@ -32,6 +38,12 @@ import (
 	"github.com/pion/webrtc/v4"
 )
 
+// iceRestartDelay is how long a disconnected ICE connection may try to
+// recover on its own before it is restarted.
+const iceRestartDelay = 3 * time.Second
+
+var errClientGone = errors.New("client went away during negotiation")
+
 type AddStreamAction struct {
 	Type string `json:"type"`
 	Id   string `json:"id"`
@@ -49,33 +61,61 @@ type PeerConnectionThread struct {
 	recvSDPChan       <-chan webrtc.SessionDescription
 	sendCandidateChan chan<- webrtc.ICECandidateInit
 	recvCandidateChan <-chan webrtc.ICECandidateInit
+	sendStatsChan     chan<- signalingdto.StatsDTO
 	peerConnection    *webrtc.PeerConnection
 	gameConfig        *config.GameConfig
 	gamepadControl    *GamepadControl
 	estimatorChan     chan cc.BandwidthEstimator
+	nackResponder     *nack.ResponderInterceptor
+	fecInterceptor    *flexfec.FecInterceptor
 	cpuProfile        string
 	videoDriverLabel  string
 	sessionConfig     *config.SessionConfig
 	endWsPromise      <-chan struct{}
+	iceRestart        bool
+	remoteOffers      bool
+	restartICEChan    chan struct{}
+	// remote candidates received while an offer is waiting for its answer
+	candidatesLock    sync.Mutex
+	negotiating       bool
+	pendingCandidates []webrtc.ICECandidateInit
+	// estimator is set once the peer connection is connected
+	estimator     cc.BandwidthEstimator
+	estimatorLock sync.Mutex
+	endGameOnce   sync.Once
 }
 
 func NewPeerConnectionThread(
+	sessionID string,
 	sendSDPChan chan<- webrtc.SessionDescription,
 	recvSDPChan <-chan webrtc.SessionDescription,
 	sendCandidateChan chan<- webrtc.ICECandidateInit,
 	recvCandidateChan <-chan webrtc.ICECandidateInit,
+	sendStatsChan chan<- signalingdto.StatsDTO,
 	cfg *config.Config,
 	sessionConfig *config.SessionConfig,
 	cpuProfile string,
 	endWsPromise <-chan struct{},
-) *PeerConnectionThread {
+	iceRestart bool,
+	remoteOffers bool,
+) (_ *PeerConnectionThread, err error) {
+	// release what was created so far if the session fails to start
+	cleanups := []func(){}
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}()
 	m := &webrtc.MediaEngine{}
 	i := &interceptor.Registry{}
-	codecselector, err := configureCodec(m, sessionConfig.CodecConfig)
+	codecselector, err := configureCodec(m, sessionConfig.CodecConfig, cfg.DevicePath)
 	if err != nil {
-		panic(err)
+		return nil, sessionError(StageCodec, err)
 	}
-	// pacer := gcc.NewLeakyBucketPacer(int(float32(sessionConfig.CodecConfig.InitialBitrate) * 1.5))
+	// pacer, err := gcc.NewLeakyBucketPacer(int(float32(sessionConfig.CodecConfig.InitialBitrate)*1.5), gcc.LeakyBucketPacerStatsFilePrefix(sessionID+"_"))
 	pacer := gcc.NewNoOpPacer()
 	congestionControllerFactory, err := cc.NewInterceptor(func() (cc.BandwidthEstimator, error) {
 		return gcc.NewSendSideBWE(
@@ -83,27 +123,38 @@ func NewPeerConnectionThread(
 			gcc.SendSideBWEMaxBitrate(sessionConfig.CodecConfig.MaxBitrate),
 			gcc.SendSideBWEMinBitrate(1_000_000),
 			gcc.SendSideBWEPacer(pacer),
+			gcc.SendSideBWEStatsFilePrefix(sessionID+"_"),
 		)
 	})
 	if err != nil {
-		panic(err)
+		return nil, sessionError(StageWebRTC, err)
 	}
 	estimatorChan := make(chan cc.BandwidthEstimator, 1)
 	congestionControllerFactory.OnNewPeerConnection(func(id string, estimator cc.BandwidthEstimator) { //nolint: revive
 		estimatorChan <- estimator
 	})
-	nackResponder, err := nack.NewResponderInterceptor()
+	// the interceptors are created by api.NewPeerConnection below,
+	// keep the session's own instances for bitrate accounting
+	var nackResponder *nack.ResponderInterceptor
+	var fecInterceptor *flexfec.FecInterceptor
+	nackResponderFactory, err := nack.NewResponderInterceptor()
 	if err != nil {
-		panic(err)
+		return nil, sessionError(StageWebRTC, err)
 	}
-	// fecInterceptor, err := flexfec.NewFecInterceptor()
+	nackResponderFactory.OnNewResponder(func(_ string, responder *nack.ResponderInterceptor) {
+		nackResponder = responder
+	})
+	// fecInterceptorFactory, err := flexfec.NewFecInterceptor()
 	// if err != nil {
 	// 	panic(err)
 	// }
+	// fecInterceptorFactory.OnNewFecInterceptor(func(_ string, fec *flexfec.FecInterceptor) {
+	// 	fecInterceptor = fec
+	// })
 	if err := m.RegisterHeaderExtension(
 		webrtc.RTPHeaderExtensionCapability{URI: sdp.TransportCCURI}, webrtc.RTPCodecTypeVideo,
 	); err != nil {
-		panic(err)
+		return nil, sessionError(StageWebRTC, err)
 	}
 	// TODO: add audio
 	// if err := m.RegisterHeaderExtension(
@@ -113,48 +164,71 @@ func NewPeerConnectionThread(
 	// }
 	twccInterceptor, err := twcc.NewHeaderExtensionInterceptor()
 	if err != nil {
-		panic(err)
+		return nil, sessionError(StageWebRTC, err)
 	}
 	senderReportInterceptor, err := report.NewSenderInterceptor()
 	if err != nil {
-		panic(err)
+		return nil, sessionError(StageWebRTC, err)
 	}
 	frameTypeInterceptor, err := frametype.NewFrameTypeInterceptor()
 	if err != nil {
-		panic(err)
+		return nil, sessionError(StageWebRTC, err)
 	}
 	i.Add(senderReportInterceptor)
 	i.Add(congestionControllerFactory)
 	i.Add(twccInterceptor)
 	// FIXME: currently, the flexfec implementation cause video content
 	// broken when fec payload are actually used when loss occurs.
-	// i.Add(fecInterceptor)
-	i.Add(nackResponder)
+	// i.Add(fecInterceptorFactory)
+	i.Add(nackResponderFactory)
 	i.Add(frameTypeInterceptor)
 	settingEngine := webrtc.SettingEngine{}
 	settingEngine.SetEphemeralUDPPortRange(cfg.EphemeralUDPPortMin, cfg.EphemeralUDPPortMax)
+	cfg.ICE.ConfigureSettingEngine(&settingEngine)
 	api := webrtc.NewAPI(
 		webrtc.WithMediaEngine(m),
 		webrtc.WithInterceptorRegistry(i),
 		webrtc.WithSettingEngine(settingEngine),
 	)
 	config := webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{
-				URLs: []string{"stun:stun.l.google.com:19302"},
-			},
-		},
+		ICEServers: cfg.ICE.ICEServers(),
 	}
 	peerConnection, err := api.NewPeerConnection(config)
 	if err != nil {
-		panic(err)
+		return nil, sessionError(StageWebRTC, err)
 	}
+	cleanups = append(cleanups, func() {
+		if err := peerConnection.Close(); err != nil {
+			slog.Warn("failed to close peer connection", "error", err)
+		}
+	})
 	slog.Info("Created peer connection")
 
-	videoDriverLabel := gamecapture.Initialize(&sessionConfig.GameConfig)
+	gameConfig := &sessionConfig.GameConfig
+	// the game may be running even if its window never showed up
+	cleanups = append(cleanups, func() {
+		runEndGameCommands(gameConfig)
+	})
+	videoDriverLabel, err := gamecapture.Initialize(gameConfig, endWsPromise)
+	if err != nil {
+		return nil, sessionError(StageCapture, err)
+	}
+	cleanups = append(cleanups, func() {
+		if err := closeDrivers(videoDriverLabel); err != nil {
+			slog.Warn("failed to close capture driver", "error", err)
+		}
+	})
+	videoDrivers := driver.GetManager().Query(func(d driver.Driver) bool {
+		return d.Info().Label == videoDriverLabel
+	})
+	if len(videoDrivers) == 0 {
+		return nil, sessionError(StageCapture, errors.New("no driver registered for "+videoDriverLabel))
+	}
 
 	mediaStream, err := mediadevices.GetUserMedia(mediadevices.MediaStreamConstraints{
 		Video: func(constraint *mediadevices.MediaTrackConstraints) {
+			// other sessions have their own drivers registered, pin ours
+			constraint.DeviceID = prop.StringExact(videoDrivers[0].ID())
 			constraint.Width = prop.Int(1920)
 			constraint.Height = prop.Int(1080)
 			constraint.FrameRate = prop.Float(sessionConfig.CodecConfig.FrameRate)
@@ -162,7 +236,7 @@ func NewPeerConnectionThread(
 		Codec: codecselector,
 	})
 	if err != nil {
-		panic(err)
+		return nil, sessionError(StageCodec, err)
 	}
 	for _, videoTrack := range mediaStream.GetVideoTracks() {
 		videoTrack.OnEnded(func(err error) {
@@ -175,14 +249,14 @@ func NewPeerConnectionThread(
 			},
 		)
 		if err != nil {
-			panic(err)
+			return nil, sessionError(StageWebRTC, err)
 		}
 		slog.Info("add video track success", "encodings", t.Sender().GetParameters().Encodings)
 	}
 
 	gamepadControl, err := NewGamepadControl()
 	if err != nil {
-		panic(err)
+		return nil, sessionError(StageGamepad, err)
 	}
 
 	pc := &PeerConnectionThread{
@@ -190,32 +264,147 @@ func NewPeerConnectionThread(
 		recvSDPChan:       recvSDPChan,
 		sendCandidateChan: sendCandidateChan,
 		recvCandidateChan: recvCandidateChan,
+		sendStatsChan:     sendStatsChan,
 		peerConnection:    peerConnection,
-		gameConfig:        &sessionConfig.GameConfig,
+		gameConfig:        gameConfig,
 		gamepadControl:    gamepadControl,
 		estimatorChan:     estimatorChan,
+		nackResponder:     nackResponder,
+		fecInterceptor:    fecInterceptor,
 		cpuProfile:        cpuProfile,
 		videoDriverLabel:  videoDriverLabel,
 		sessionConfig:     sessionConfig,
 		endWsPromise:      endWsPromise,
+		iceRestart:        iceRestart,
+		remoteOffers:      remoteOffers,
+		restartICEChan:    make(chan struct{}, 1),
 	}
-	return pc
+	return pc, nil
 }
 
 func (pc *PeerConnectionThread) handleRemoteICECandidate() {
 	for {
-		candidate := <-pc.recvCandidateChan
-		if err := pc.peerConnection.AddICECandidate(candidate); err != nil {
-			panic(err)
+		select {
+		case candidate := <-pc.recvCandidateChan:
+			pc.candidatesLock.Lock()
+			if pc.negotiating {
+				// the candidate belongs to an answer we haven't applied yet
+				pc.pendingCandidates = append(pc.pendingCandidates, candidate)
+			} else {
+				pc.addRemoteICECandidate(candidate)
+			}
+			pc.candidatesLock.Unlock()
+		case <-pc.endWsPromise:
+			return
+		}
+	}
+}
+
+func (pc *PeerConnectionThread) addRemoteICECandidate(candidate webrtc.ICECandidateInit) {
+	if candidate.Candidate == "" {
+		slog.Info("remote end of candidates")
+	}
+	if err := pc.peerConnection.AddICECandidate(candidate); err != nil {
+		slog.Warn("failed to add remote ICE candidate", "candidate", candidate.Candidate, "error", err)
+	}
+}
+
+// negotiate sends an offer to the client and applies its answer.
+func (pc *PeerConnectionThread) negotiate(options *webrtc.OfferOptions) error {
+	offer, err := pc.peerConnection.CreateOffer(options)
+	if err != nil {
+		return err
+	}
+	pc.candidatesLock.Lock()
+	pc.negotiating = true
+	pc.candidatesLock.Unlock()
+	defer func() {
+		pc.candidatesLock.Lock()
+		defer pc.candidatesLock.Unlock()
+		pc.negotiating = false
+		for _, candidate := range pc.pendingCandidates {
+			pc.addRemoteICECandidate(candidate)
 		}
+		pc.pendingCandidates = nil
+	}()
+	// hand the offer over before gathering starts in SetLocalDescription,
+	// so that none of our candidates overtakes it on the websocket
+	select {
+	case pc.sendSDPChan <- offer:
+	case <-pc.endWsPromise:
+		return errClientGone
+	}
+	if err := pc.peerConnection.SetLocalDescription(offer); err != nil {
+		return err
 	}
+	var remoteSDP webrtc.SessionDescription
+	select {
+	case remoteSDP = <-pc.recvSDPChan:
+	case <-pc.endWsPromise:
+		return errClientGone
+	}
+	slog.Info("Before calling SetRemoteDescription", "sender parameters", pc.peerConnection.GetTransceivers()[0].Sender().GetParameters())
+	return pc.peerConnection.SetRemoteDescription(remoteSDP)
 }
 
-func (pc *PeerConnectionThread) Spin() {
-	endSpinPromise := make(chan struct{})
+// answer waits for the client's offer and sends back an answer that carries
+// all of our candidates, for clients that can't receive trickled ones.
+func (pc *PeerConnectionThread) answer() error {
+	var remoteSDP webrtc.SessionDescription
+	select {
+	case remoteSDP = <-pc.recvSDPChan:
+	case <-pc.endWsPromise:
+		return errClientGone
+	}
+	if err := pc.peerConnection.SetRemoteDescription(remoteSDP); err != nil {
+		return err
+	}
+	answer, err := pc.peerConnection.CreateAnswer(nil)
+	if err != nil {
+		return err
+	}
+	gatherComplete := webrtc.GatheringCompletePromise(pc.peerConnection)
+	if err := pc.peerConnection.SetLocalDescription(answer); err != nil {
+		return err
+	}
+	select {
+	case <-gatherComplete:
+	case <-pc.endWsPromise:
+		return errClientGone
+	}
+	select {
+	case pc.sendSDPChan <- *pc.peerConnection.LocalDescription():
+	case <-pc.endWsPromise:
+		return errClientGone
+	}
+	return nil
+}
+
+// restartICE asks Spin to renegotiate with fresh ICE credentials if the
+// connection is still down and the client supports renegotiation.
+func (pc *PeerConnectionThread) restartICE() {
+	if !pc.iceRestart {
+		return
+	}
+	switch pc.peerConnection.ICEConnectionState() {
+	case webrtc.ICEConnectionStateDisconnected, webrtc.ICEConnectionStateFailed:
+	default:
+		return
+	}
+	select {
+	case pc.restartICEChan <- struct{}{}:
+	default:
+	}
+}
+
+// Spin runs the session until either the client or the peer connection
+// goes away, then releases everything the session created. The returned
+// error is a *SessionError when the session failed rather than ended.
+func (pc *PeerConnectionThread) Spin() error {
+	endSpinPromise := make(chan struct{}, 1)
 	datachannel, err := pc.peerConnection.CreateDataChannel("controller", nil)
 	if err != nil {
-		panic(err)
+		return pc.fail(sessionError(StageWebRTC, err))
 	}
 	datachannel.OnOpen(func() {
 		slog.Info("datachannel open", "label", datachannel.Label(), "ID", datachannel.ID())
@@ -230,27 +419,40 @@ func (pc *PeerConnectionThread) Spin() {
 		pc.gamepadControl.SendGamepadState(dto)
 	})
 
-	offer, err := pc.peerConnection.CreateOffer(nil)
-	if err != nil {
-		panic(err)
-	}
-	pc.peerConnection.SetLocalDescription(offer)
 	pc.peerConnection.OnICECandidate(func(c *webrtc.ICECandidate) {
-		if c == nil {
-			return
+		// an empty candidate tells the client that gathering is complete
+		candidate := webrtc.ICECandidateInit{}
+		if c != nil {
+			candidate = c.ToJSON()
+		}
+		select {
+		case pc.sendCandidateChan <- candidate:
+		case <-pc.endWsPromise:
+		}
+	})
+	pc.peerConnection.OnICEConnectionStateChange(func(s webrtc.ICEConnectionState) {
+		switch s {
+		case webrtc.ICEConnectionStateDisconnected:
+			time.AfterFunc(iceRestartDelay, pc.restartICE)
+		case webrtc.ICEConnectionStateFailed:
+			pc.restartICE()
 		}
-		pc.sendCandidateChan <- c.ToJSON()
 	})
 	var f *os.File
 	if pc.cpuProfile != "" {
 		f, err = os.Create(pc.cpuProfile)
 		if err != nil {
-			panic(err)
+			slog.Warn("failed to create cpu profile, not profiling", "error", err)
 		}
 	}
+	var connected atomic.Bool
 	pc.peerConnection.OnConnectionStateChange(func(s webrtc.PeerConnectionState) {
 		switch s {
 		case webrtc.PeerConnectionStateConnected:
+			if connected.Swap(true) {
+				slog.Info("Peer connection reconnected")
+				break
+			}
 			senders := pc.peerConnection.GetSenders()
 			var bitrateController codec.BitRateController
 			for _, sender := range senders {
@@ -266,11 +468,21 @@ func (pc *PeerConnectionThread) Spin() {
 				}
 			}
 			estimator := <-pc.estimatorChan
+			pc.estimatorLock.Lock()
+			pc.estimator = estimator
+			pc.estimatorLock.Unlock()
+			go pc.sendStats(estimator)
 			currentVideoBitrate := pc.sessionConfig.CodecConfig.InitialBitrate
 			if bitrateController != nil {
 				estimator.OnTargetBitrateChange(func(bitrate int) {
-					nackBitrate := nack.GetNACKBitRate()
-					fecBitrate := flexfec.GetFECBitrate()
+					nackBitrate := 0.0
+					if pc.nackResponder != nil {
+						nackBitrate = pc.nackResponder.GetNACKBitRate()
+					}
+					fecBitrate := 0.0
+					if pc.fecInterceptor != nil {
+						fecBitrate = pc.fecInterceptor.GetFECBitRate()
+					}
 					videoBitrate := bitrate - int(nackBitrate) - int(fecBitrate)
 					// TODO: minus audio bitrate here
 					// only call SetBitrate if bitrate change is large enough
@@ -307,82 +519,223 @@ func (pc *PeerConnectionThread) Spin() {
 				f.Close()
 			}
 			slog.Info("Peer connection closed")
-			// kill game processes
-			for _, processConfig := range pc.gameConfig.EndGameCommands {
-				args := []string{"killall"}
-				if len(processConfig.Flags) != 0 {
-					args = append(args, processConfig.Flags...)
-				} else {
-					args = append(args, "-v", "-w")
-				}
-				args = append(args, processConfig.ProcessName)
-				// print command
-				slog.Info("Killing game process", "command", strings.Join(args, " "))
-				cmd := exec.Command(args[0], args[1:]...)
-				_, err := cmd.Output()
-				if err != nil {
-					slog.Error("Failed to kill game process", "error", err)
-					continue
-				}
+			pc.endGame()
+			select {
+			case endSpinPromise <- struct{}{}:
+			default:
 			}
-			endSpinPromise <- struct{}{}
 		}
 	})
 	go pc.handleRemoteICECandidate()
-	pc.sendSDPChan <- offer
-	remoteSDP := <-pc.recvSDPChan
-	slog.Info("Before calling SetRemoteDescription", "sender parameters", pc.peerConnection.GetTransceivers()[0].Sender().GetParameters())
-	pc.peerConnection.SetRemoteDescription(remoteSDP)
+	if pc.remoteOffers {
+		err = pc.answer()
+	} else {
+		err = pc.negotiate(nil)
+	}
+	if err != nil {
+		if !errors.Is(err, errClientGone) {
+			return pc.fail(sessionError(StageNegotiation, err))
+		}
+		return pc.close()
+	}
 
-	select {
-	case <-pc.endWsPromise:
-		pc.close()
-	case <-endSpinPromise:
-		pc.close()
+	for {
+		select {
+		case <-pc.restartICEChan:
+			slog.Info("Restarting ICE")
+			if err := pc.negotiate(&webrtc.OfferOptions{ICERestart: true}); err != nil {
+				if errors.Is(err, errClientGone) {
+					return pc.close()
+				}
+				slog.Error("ICE restart failed", "error", err)
+			}
+		case <-pc.endWsPromise:
+			return pc.close()
+		case <-endSpinPromise:
+			return pc.close()
+		}
+	}
+}
+
+// fail releases the session after err, cleanup errors are only logged since
+// err is what the client needs to know about.
+func (pc *PeerConnectionThread) fail(err *SessionError) error {
+	if closeErr := pc.close(); closeErr != nil {
+		slog.Warn("failed to clean up after session error", "error", closeErr)
+	}
+	return err
+}
+
+// sendStats reports the bandwidth estimator state to the client every second.
+func (pc *PeerConnectionThread) sendStats(estimator cc.BandwidthEstimator) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			stats := signalingdto.StatsDTO(estimator.GetStats())
+			stats["targetBitrate"] = estimator.GetTargetBitrate()
+			select {
+			case pc.sendStatsChan <- stats:
+			case <-pc.endWsPromise:
+				return
+			}
+		case <-pc.endWsPromise:
+			return
+		}
+	}
+}
+
+// endGame runs the EndGameCommands of the game, once.
+func (pc *PeerConnectionThread) endGame() {
+	pc.endGameOnce.Do(func() {
+		runEndGameCommands(pc.gameConfig)
+	})
+}
+
+func runEndGameCommands(gameConfig *config.GameConfig) {
+	// kill game processes
+	for _, processConfig := range gameConfig.EndGameCommands {
+		args := []string{"killall"}
+		if len(processConfig.Flags) != 0 {
+			args = append(args, processConfig.Flags...)
+		} else {
+			args = append(args, "-v", "-w")
+		}
+		args = append(args, processConfig.ProcessName)
+		// print command
+		slog.Info("Killing game process", "command", strings.Join(args, " "))
+		cmd := exec.Command(args[0], args[1:]...)
+		_, err := cmd.Output()
+		if err != nil {
+			slog.Error("Failed to kill game process", "error", err)
+			continue
+		}
+	}
+}
+
+// ConnectionState returns the state of the peer connection.
+func (pc *PeerConnectionThread) ConnectionState() webrtc.PeerConnectionState {
+	return pc.peerConnection.ConnectionState()
+}
+
+// ICEConnectionState returns the ICE state of the peer connection.
+func (pc *PeerConnectionThread) ICEConnectionState() webrtc.ICEConnectionState {
+	return pc.peerConnection.ICEConnectionState()
+}
+
+func (pc *PeerConnectionThread) getEstimator() cc.BandwidthEstimator {
+	pc.estimatorLock.Lock()
+	defer pc.estimatorLock.Unlock()
+	return pc.estimator
+}
+
+// TargetBitrate returns the bitrate the congestion controller aims for, or
+// 0 before the peer connection is connected.
+func (pc *PeerConnectionThread) TargetBitrate() int {
+	estimator := pc.getEstimator()
+	if estimator == nil {
+		return 0
+	}
+	return estimator.GetTargetBitrate()
+}
+
+// EstimatorStats returns the state of the congestion controller, or an
+// empty map before the peer connection is connected.
+func (pc *PeerConnectionThread) EstimatorStats() map[string]interface{} {
+	estimator := pc.getEstimator()
+	if estimator == nil {
+		return map[string]interface{}{}
+	}
+	return estimator.GetStats()
+}
+
+// NACKBitrate returns the bitrate spent on retransmissions.
+func (pc *PeerConnectionThread) NACKBitrate() float64 {
+	if pc.nackResponder == nil {
+		return 0
 	}
+	// the congestion control loop measures with GetNACKBitRate
+	return pc.nackResponder.PeekNACKBitRate()
 }
 
-func (pc *PeerConnectionThread) close() {
+// WebRTCStats returns the standard WebRTC stats of the peer connection.
+func (pc *PeerConnectionThread) WebRTCStats() webrtc.StatsReport {
+	return pc.peerConnection.GetStats()
+}
+
+// close releases everything the session created. It keeps going when a
+// step fails, so that one bad device doesn't leave the others open, and
+// returns the errors together.
+func (pc *PeerConnectionThread) close() error {
+	var errs []error
 	// close all driver and encoder
 	if err := pc.gamepadControl.Close(); err != nil {
 		slog.Error("failed to close gamepad control", "error", err)
-		panic(err)
+		errs = append(errs, err)
 	}
-	drivers := driver.GetManager().Query(func(d driver.Driver) bool {
-		if d.Info().Label == pc.videoDriverLabel {
-			return true
+	if err := closeDrivers(pc.videoDriverLabel); err != nil {
+		errs = append(errs, err)
+	}
+	transceivers := pc.peerConnection.GetTransceivers()
+	for _, t := range transceivers {
+		if err := t.Stop(); err != nil {
+			slog.Error("failed to stop transceiver", "error", err)
+			errs = append(errs, err)
 		}
-		return false
+	}
+	if err := pc.peerConnection.GracefulClose(); err != nil {
+		slog.Error("failed to close peer connection", "error", err)
+		errs = append(errs, err)
+	}
+	// normally done on PeerConnectionStateClosed already
+	pc.endGame()
+	slog.Info("peer connection thread closed")
+	if len(errs) != 0 {
+		return sessionError(StageCleanup, errors.Join(errs...))
+	}
+	return nil
+}
+
+// closeDrivers closes and unregisters the capture drivers labeled label.
+func closeDrivers(label string) error {
+	drivers := driver.GetManager().Query(func(d driver.Driver) bool {
+		return d.Info().Label == label
 	})
 	if len(drivers) == 0 {
 		slog.Warn("no driver to close")
 	}
+	var errs []error
 	for _, d := range drivers {
 		if err := d.Close(); err != nil {
 			slog.Error("failed to close driver "+d.Info().Label, "error", err)
-			panic(err)
+			errs = append(errs, err)
 		}
+		// unregister the driver, otherwise the next session's GetUserMedia
+		// would open it again and capture a stale window
+		driver.GetManager().Delete(d.ID())
 	}
-	transceivers := pc.peerConnection.GetTransceivers()
-	for _, t := range transceivers {
-		if err := t.Stop(); err != nil {
-			slog.Error("failed to stop transceiver", "error", err)
-			panic(err)
+	return errors.Join(errs...)
+}
+
+// AvailableCodecs returns the codecs of config.Codecs FFmpeg has an
+// encoder for.
+func AvailableCodecs() []string {
+	codecs := []string{}
+	for _, name := range config.Codecs {
+		if astiav.FindEncoderByName(name) != nil {
+			codecs = append(codecs, name)
 		}
 	}
-	if err := pc.peerConnection.GracefulClose(); err != nil {
-		slog.Error("failed to close peer connection", "error", err)
-		panic(err)
-	}
-	slog.Info("peer connection thread closed")
+	return codecs
 }
 
-func configureCodec(m *webrtc.MediaEngine, config config.CodecConfig) (*mediadevices.CodecSelector, error) {
+func configureCodec(m *webrtc.MediaEngine, config config.CodecConfig, devicePath string) (*mediadevices.CodecSelector, error) {
 	var codecSelectorOption mediadevices.CodecSelectorOption
 	switch config.Codec {
 	case "av1_nvenc":
 		params, err := ffmpeg.NewAV1NVENCParams(
-			"/dev/dri/card1",
+			devicePath,
 			astiav.PixelFormat(astiav.PixelFormatBgra),
 		)
 		if err != nil {
@@ -394,7 +747,7 @@ func configureCodec(m *webrtc.MediaEngine, config config.CodecConfig) (*mediadev
 		codecSelectorOption = mediadevices.WithVideoEncoders(&params)
 	case "hevc_nvenc":
 		params, err := ffmpeg.NewH265NVENCParams(
-			"/dev/dri/card1",
+			devicePath,
 			astiav.PixelFormat(astiav.PixelFormatBgra),
 		)
 		if err != nil {
@@ -406,7 +759,7 @@ func configureCodec(m *webrtc.MediaEngine, config config.CodecConfig) (*mediadev
 		codecSelectorOption = mediadevices.WithVideoEncoders(&params)
 	case "h264_nvenc":
 		params, err := ffmpeg.NewH264NVENCParams(
-			"/dev/dri/card1",
+			devicePath,
 			astiav.PixelFormat(astiav.PixelFormatBgra),
 		)
 		if err != nil {
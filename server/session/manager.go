@@ -0,0 +1,337 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/3DRX/vaporplay/admindto"
+	"github.com/3DRX/vaporplay/config"
+	"github.com/3DRX/vaporplay/server/peerconnection"
+	"github.com/3DRX/vaporplay/server/signaling"
+	"github.com/3DRX/vaporplay/server/turnserver"
+	"github.com/3DRX/vaporplay/signalingdto"
+	"github.com/pion/webrtc/v4"
+)
+
+// Manager turns every receiver handed over by the signaling thread into a
+// streaming session. Sessions run concurrently, each with its own peer
+// connection, capture driver, gamepad and game process.
+type Manager struct {
+	reloader   *config.Reloader
+	cpuProfile string
+	turnServer *turnserver.TURNServer
+
+	sessions     map[string]*session
+	sessionsLock sync.Mutex
+	profiling    bool
+	// closing rejects new sessions once Shutdown started
+	closing bool
+	running sync.WaitGroup
+}
+
+var (
+	errGameRunning  = errors.New("game is already running in another session")
+	errShuttingDown = errors.New("server is shutting down")
+	// errSessionPanicked wraps a panic of a session
+	errSessionPanicked = errors.New("session panicked")
+)
+
+type session struct {
+	receiver *signaling.Receiver
+	// pc is nil until the peer connection is set up
+	pc        *peerconnection.PeerConnectionThread
+	startedAt time.Time
+}
+
+// NewManager creates a session manager, turnServer is nil when the embedded
+// TURN server is disabled. Every session runs with the config that was
+// current when it started.
+func NewManager(reloader *config.Reloader, cpuProfile string, turnServer *turnserver.TURNServer) *Manager {
+	return &Manager{
+		reloader:   reloader,
+		cpuProfile: cpuProfile,
+		turnServer: turnServer,
+		sessions:   map[string]*session{},
+	}
+}
+
+// Spin starts a session for every receiver until receivers is closed.
+func (m *Manager) Spin(receivers <-chan *signaling.Receiver) {
+	for receiver := range receivers {
+		if err := m.addSession(receiver); err != nil {
+			if err := receiver.CloseWithError(
+				signalingdto.ErrorCodeSessionRejected,
+				err.Error(),
+			); err != nil {
+				slog.Warn("failed to close receiver", "error", err)
+			}
+			continue
+		}
+		go m.runSession(receiver)
+	}
+}
+
+// addSession registers the receiver as a running session. Two sessions
+// can't run the same game, since they would launch, capture and kill the
+// same window and processes.
+func (m *Manager) addSession(receiver *signaling.Receiver) error {
+	m.sessionsLock.Lock()
+	defer m.sessionsLock.Unlock()
+	if m.closing {
+		return errShuttingDown
+	}
+	gameId := receiver.SessionConfig.GameConfig.GameId
+	for id, s := range m.sessions {
+		if s.receiver.SessionConfig.GameConfig.GameId == gameId {
+			slog.Warn("game is already running in another session, rejecting", "id", receiver.ID, "game", gameId, "running", id)
+			return errGameRunning
+		}
+	}
+	m.sessions[receiver.ID] = &session{
+		receiver:  receiver,
+		startedAt: time.Now(),
+	}
+	m.running.Add(1)
+	return nil
+}
+
+func (m *Manager) setPeerConnection(receiver *signaling.Receiver, pc *peerconnection.PeerConnectionThread) {
+	m.sessionsLock.Lock()
+	defer m.sessionsLock.Unlock()
+	if s, ok := m.sessions[receiver.ID]; ok {
+		s.pc = pc
+	}
+}
+
+func (m *Manager) removeSession(receiver *signaling.Receiver) {
+	m.sessionsLock.Lock()
+	defer m.sessionsLock.Unlock()
+	delete(m.sessions, receiver.ID)
+}
+
+// acquireProfile returns the cpu profile path if no other session is being
+// profiled, since only one cpu profile can be recorded at a time.
+func (m *Manager) acquireProfile() string {
+	m.sessionsLock.Lock()
+	defer m.sessionsLock.Unlock()
+	if m.cpuProfile == "" || m.profiling {
+		return ""
+	}
+	m.profiling = true
+	return m.cpuProfile
+}
+
+func (m *Manager) releaseProfile(profile string) {
+	if profile == "" {
+		return
+	}
+	m.sessionsLock.Lock()
+	defer m.sessionsLock.Unlock()
+	m.profiling = false
+}
+
+// runSession supervises a session. When the session fails, the client is
+// told why and everything the session created is released, the server and
+// the other sessions keep running.
+func (m *Manager) runSession(receiver *signaling.Receiver) {
+	defer m.running.Done()
+	defer m.removeSession(receiver)
+	profile := m.acquireProfile()
+	defer m.releaseProfile(profile)
+
+	slog.Info("session started", "id", receiver.ID, "game", receiver.SessionConfig.GameConfig.GameDisplayName)
+	if m.turnServer != nil {
+		m.advertiseTURNServer(receiver)
+		defer m.turnServer.Revoke(receiver.ID)
+	}
+	err := m.serveSession(receiver, profile)
+	var sessionErr *peerconnection.SessionError
+	switch {
+	case err == nil:
+		err = receiver.Close()
+	case errors.As(err, &sessionErr) && sessionErr.Stage == peerconnection.StageCleanup:
+		// the session itself ended normally
+		slog.Warn("session cleanup failed", "id", receiver.ID, "error", err)
+		err = receiver.Close()
+	case errors.As(err, &sessionErr):
+		slog.Error("session failed", "id", receiver.ID, "stage", sessionErr.Stage, "error", err)
+		err = receiver.CloseWithError(signalingdto.ErrorCodeSessionFailed, sessionErr.Message())
+	default:
+		slog.Error("session failed", "id", receiver.ID, "error", err)
+		err = receiver.CloseWithError(signalingdto.ErrorCodeSessionFailed, "internal server error")
+	}
+	if err != nil {
+		slog.Warn("failed to close receiver", "error", err)
+	}
+	slog.Info("session ended", "id", receiver.ID, "game", receiver.SessionConfig.GameConfig.GameDisplayName)
+}
+
+// serveSession sets up the peer connection of a session and runs it. A
+// panic is turned into an error, so it only ends this session.
+func (m *Manager) serveSession(receiver *signaling.Receiver, profile string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("session panicked", "id", receiver.ID, "panic", r, "stack", string(debug.Stack()))
+			err = fmt.Errorf("%w: %v", errSessionPanicked, r)
+		}
+	}()
+	peerConnectionThread, err := peerconnection.NewPeerConnectionThread(
+		receiver.ID,
+		receiver.SendSDPChan,
+		receiver.RecvSDPChan,
+		receiver.SendCandidateChan,
+		receiver.RecvCandidateChan,
+		receiver.SendStatsChan,
+		m.reloader.Config(),
+		receiver.SessionConfig,
+		profile,
+		receiver.EndWsPromise,
+		receiver.CanRestartICE(),
+		receiver.RemoteOffers(),
+	)
+	if err != nil {
+		return err
+	}
+	m.setPeerConnection(receiver, peerConnectionThread)
+	return peerConnectionThread.Spin()
+}
+
+func (m *Manager) advertiseTURNServer(receiver *signaling.Receiver) {
+	iceServer, err := m.turnServer.Credentials(receiver.ID)
+	if err != nil {
+		slog.Error("failed to issue TURN credentials", "id", receiver.ID, "error", err)
+		return
+	}
+	if err := receiver.SendICEServers([]signalingdto.ICEServerDTO{iceServer}); err != nil {
+		slog.Error("failed to advertise TURN server", "id", receiver.ID, "error", err)
+	}
+}
+
+func (s *session) info() admindto.SessionDTO {
+	gameConfig := &s.receiver.SessionConfig.GameConfig
+	codecConfig := &s.receiver.SessionConfig.CodecConfig
+	info := admindto.SessionDTO{
+		ID:              s.receiver.ID,
+		GameID:          gameConfig.GameId,
+		GameDisplayName: gameConfig.GameDisplayName,
+		Codec:           codecConfig.Codec,
+		FrameRate:       codecConfig.FrameRate,
+		State:           "starting",
+		TargetBitrate:   0,
+		StartedAt:       s.startedAt,
+		Uptime:          time.Since(s.startedAt).Seconds(),
+	}
+	if s.pc != nil {
+		info.State = s.pc.ConnectionState().String()
+		info.TargetBitrate = s.pc.TargetBitrate()
+	}
+	return info
+}
+
+// Sessions lists the running sessions.
+func (m *Manager) Sessions() []admindto.SessionDTO {
+	m.sessionsLock.Lock()
+	defer m.sessionsLock.Unlock()
+	sessions := make([]admindto.SessionDTO, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		sessions = append(sessions, s.info())
+	}
+	return sessions
+}
+
+// SessionStats returns the detailed stats of a running session.
+func (m *Manager) SessionStats(id string) (*admindto.SessionStatsDTO, bool) {
+	m.sessionsLock.Lock()
+	s, ok := m.sessions[id]
+	if !ok {
+		m.sessionsLock.Unlock()
+		return nil, false
+	}
+	info := s.info()
+	pc := s.pc
+	m.sessionsLock.Unlock()
+	stats := &admindto.SessionStatsDTO{
+		SessionDTO: info,
+		ICEState:   webrtc.ICEConnectionStateNew.String(),
+		Estimator:  map[string]interface{}{},
+		WebRTC:     webrtc.StatsReport{},
+	}
+	if pc != nil {
+		stats.ICEState = pc.ICEConnectionState().String()
+		stats.NACKBitrate = pc.NACKBitrate()
+		stats.Estimator = pc.EstimatorStats()
+		stats.WebRTC = pc.WebRTCStats()
+	}
+	return stats, true
+}
+
+// Terminate ends a running session like a client leaving would, which
+// closes the peer connection and runs the EndGameCommands of the game.
+func (m *Manager) Terminate(id string) bool {
+	m.sessionsLock.Lock()
+	s, ok := m.sessions[id]
+	m.sessionsLock.Unlock()
+	if !ok {
+		return false
+	}
+	slog.Info("terminating session", "id", id, "game", s.receiver.SessionConfig.GameConfig.GameDisplayName)
+	if err := s.receiver.CloseWithReason("session terminated by the server"); err != nil {
+		slog.Warn("failed to close receiver", "error", err)
+	}
+	return true
+}
+
+// Capabilities describes what the server supports.
+func (m *Manager) Capabilities() admindto.CapabilitiesDTO {
+	m.sessionsLock.Lock()
+	sessions := len(m.sessions)
+	m.sessionsLock.Unlock()
+	cfg := m.reloader.Config()
+	return admindto.CapabilitiesDTO{
+		ProtocolVersions: []int{signalingdto.LegacyProtocolVersion, signalingdto.ProtocolVersion},
+		Codecs:           peerconnection.AvailableCodecs(),
+		WHEP:             true,
+		TURN:             m.turnServer != nil,
+		TLS:              cfg.TLS.Enabled,
+		Auth:             cfg.Auth.Enabled(),
+		Pairing:          cfg.Auth.Pairing,
+		Sessions:         sessions,
+	}
+}
+
+// Shutdown ends every running session like Terminate and rejects new ones,
+// then waits until the sessions released their peer connection, drivers and
+// gamepad and ran their EndGameCommands, or until ctx is done.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.sessionsLock.Lock()
+	m.closing = true
+	receivers := make([]*signaling.Receiver, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		receivers = append(receivers, s.receiver)
+	}
+	m.sessionsLock.Unlock()
+	slog.Info("ending sessions", "sessions", len(receivers))
+	for _, receiver := range receivers {
+		go func() {
+			if err := receiver.CloseWithReason("server is shutting down"); err != nil {
+				slog.Warn("failed to close receiver", "error", err)
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
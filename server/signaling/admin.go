@@ -0,0 +1,50 @@
+package signaling
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/3DRX/vaporplay/admindto"
+)
+
+// SessionAdmin inspects and terminates the running sessions for the admin
+// API.
+type SessionAdmin interface {
+	Sessions() []admindto.SessionDTO
+	SessionStats(id string) (*admindto.SessionStatsDTO, bool)
+	Terminate(id string) bool
+	Capabilities() admindto.CapabilitiesDTO
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("failed to write response", "error", err)
+	}
+}
+
+func (s *SignalingThread) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.sessionAdmin.Sessions())
+}
+
+func (s *SignalingThread) handleSessionStats(w http.ResponseWriter, r *http.Request) {
+	stats, ok := s.sessionAdmin.SessionStats(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "no such session", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, stats)
+}
+
+func (s *SignalingThread) handleTerminateSession(w http.ResponseWriter, r *http.Request) {
+	if !s.sessionAdmin.Terminate(r.PathValue("id")) {
+		http.Error(w, "no such session", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *SignalingThread) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.sessionAdmin.Capabilities())
+}
@@ -0,0 +1,79 @@
+package signaling
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/3DRX/vaporplay/config"
+)
+
+// writeGameError maps catalog errors to status codes, anything else failed
+// to be written to the config file.
+func writeGameError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, config.ErrGameExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, config.ErrUnknownGame):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, config.ErrInvalidGame):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		slog.Error("failed to save games", "error", err)
+		http.Error(w, "failed to save games", http.StatusInternalServerError)
+	}
+}
+
+func decodeGame(r *http.Request) (config.GameConfig, error) {
+	game := config.GameConfig{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&game)
+	return game, err
+}
+
+func (s *SignalingThread) handleAddGame(w http.ResponseWriter, r *http.Request) {
+	game, err := decodeGame(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.games.Add(game); err != nil {
+		writeGameError(w, err)
+		return
+	}
+	slog.Info("game added", "game", game.GameId, "name", game.GameDisplayName)
+	w.Header().Set("Location", "/games/"+game.GameId)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(game)
+}
+
+func (s *SignalingThread) handleUpdateGame(w http.ResponseWriter, r *http.Request) {
+	game, err := decodeGame(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id := r.PathValue("id")
+	if game.GameId == "" {
+		game.GameId = id
+	}
+	if err := s.games.Update(id, game); err != nil {
+		writeGameError(w, err)
+		return
+	}
+	slog.Info("game updated", "game", id, "name", game.GameDisplayName)
+	writeJSON(w, game)
+}
+
+func (s *SignalingThread) handleRemoveGame(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.games.Remove(id); err != nil {
+		writeGameError(w, err)
+		return
+	}
+	slog.Info("game removed", "game", id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,173 @@
+package signaling
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/3DRX/vaporplay/config"
+	"github.com/3DRX/vaporplay/steam"
+)
+
+// iconResolveInterval is how long the icon file of a game is remembered,
+// so listing the games doesn't look at every icon file.
+const iconResolveInterval = time.Minute
+
+type icon struct {
+	path        string
+	modTime     time.Time
+	data        []byte
+	contentType string
+	etag        string
+}
+
+// resolvedIcon is the icon file of a game, or that it has none.
+type resolvedIcon struct {
+	gameIcon string
+	path     string
+	ok       bool
+	at       time.Time
+}
+
+// iconCache resolves and caches game icons. A game's icon is the image
+// file game_icon points to, or its artwork in the Steam librarycache.
+type iconCache struct {
+	steamRoot string
+	icons     map[string]*icon
+	resolved  map[string]resolvedIcon
+	lock      sync.Mutex
+}
+
+func newIconCache(cfg *config.Config) *iconCache {
+	c := &iconCache{
+		icons: map[string]*icon{},
+	}
+	c.setConfig(cfg)
+	return c
+}
+
+// setConfig picks up the Steam root of a reloaded config.
+func (c *iconCache) setConfig(cfg *config.Config) {
+	steamRoot := cfg.SteamImport.Root
+	if steamRoot == "" {
+		steamRoot = steam.DefaultRoot()
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.steamRoot = steamRoot
+	c.resolved = map[string]resolvedIcon{}
+}
+
+func iconURL(gameId string) string {
+	return "/games/" + gameId + "/icon"
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "/games/")
+}
+
+// resolve returns the icon file of a game, it looks for the file again
+// after iconResolveInterval or when game_icon changed.
+func (c *iconCache) resolve(game *config.GameConfig) (string, bool) {
+	c.lock.Lock()
+	r, cached := c.resolved[game.GameId]
+	steamRoot := c.steamRoot
+	c.lock.Unlock()
+	if cached && r.gameIcon == game.GameIcon && time.Since(r.at) < iconResolveInterval {
+		return r.path, r.ok
+	}
+	r = resolvedIcon{gameIcon: game.GameIcon, at: time.Now()}
+	if game.GameIcon != "" && !isURL(game.GameIcon) {
+		if info, err := os.Stat(game.GameIcon); err == nil && info.Mode().IsRegular() {
+			r.path, r.ok = game.GameIcon, true
+		} else {
+			slog.Warn("game icon not found", "game", game.GameId, "path", game.GameIcon)
+		}
+	} else {
+		r.path, r.ok = steam.Icon(steamRoot, game.GameId)
+	}
+	c.lock.Lock()
+	c.resolved[game.GameId] = r
+	c.lock.Unlock()
+	return r.path, r.ok
+}
+
+// get returns the icon of a game, the file is read again when it changed.
+func (c *iconCache) get(game *config.GameConfig) (*icon, bool) {
+	p, ok := c.resolve(game)
+	if !ok {
+		return nil, false
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if cached, ok := c.icons[game.GameId]; ok && cached.path == p && cached.modTime.Equal(info.ModTime()) {
+		return cached, true
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		slog.Warn("failed to read game icon", "game", game.GameId, "path", p, "error", err)
+		return nil, false
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(p))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	if !strings.HasPrefix(contentType, "image/") {
+		slog.Warn("game icon is not an image", "game", game.GameId, "path", p, "content type", contentType)
+		return nil, false
+	}
+	digest := sha256.Sum256(data)
+	i := &icon{
+		path:        p,
+		modTime:     info.ModTime(),
+		data:        data,
+		contentType: contentType,
+		etag:        `"` + hex.EncodeToString(digest[:16]) + `"`,
+	}
+	c.icons[game.GameId] = i
+	return i, true
+}
+
+// withIcons points game_icon of every game with an icon to its icon
+// endpoint.
+func (c *iconCache) withIcons(games []config.GameConfig) []config.GameConfig {
+	for i := range games {
+		if isURL(games[i].GameIcon) {
+			continue
+		}
+		games[i].GameIcon = ""
+		if _, ok := c.resolve(&games[i]); ok {
+			games[i].GameIcon = iconURL(games[i].GameId)
+		}
+	}
+	return games
+}
+
+func (s *SignalingThread) handleGameIcon(w http.ResponseWriter, r *http.Request) {
+	game, ok := s.games.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "no such game", http.StatusNotFound)
+		return
+	}
+	i, ok := s.icons.get(&game)
+	if !ok {
+		http.Error(w, "game has no icon", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", i.contentType)
+	w.Header().Set("ETag", i.etag)
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeContent(w, r, "", i.modTime, bytes.NewReader(i.data))
+}
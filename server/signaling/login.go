@@ -0,0 +1,114 @@
+package signaling
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const loginPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>VaporPlay</title>
+<style>
+body { font-family: sans-serif; background: #111; color: #eee; display: flex; justify-content: center; margin-top: 20vh; }
+form { display: flex; flex-direction: column; gap: 8px; width: 260px; }
+input, button { padding: 8px; }
+.error { color: #f66; }
+</style>
+</head>
+<body>
+<form method="post" action="/login">
+<h2>VaporPlay</h2>
+{{ERROR}}
+<input name="username" placeholder="Username" autocomplete="username">
+<input name="password" type="password" placeholder="Password" autocomplete="current-password">
+<input name="token" type="password" placeholder="or Token">
+<button type="submit">Log in</button>
+</form>
+</body>
+</html>
+`
+
+type loginDTO struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Token    string `json:"token"`
+}
+
+type loginResponseDTO struct {
+	Token string `json:"token"`
+}
+
+func (s *SignalingThread) handleLoginPage(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticator.Enabled() {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	errorMessage := ""
+	if r.URL.Query().Has("failed") {
+		errorMessage = `<p class="error">Invalid credentials</p>`
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(strings.Replace(loginPage, "{{ERROR}}", errorMessage, 1)))
+}
+
+// handleLogin starts a login session for a username and password or a
+// token. Forms get a session cookie and are redirected to the web UI, JSON
+// requests get the session token to use as a bearer token.
+func (s *SignalingThread) handleLogin(w http.ResponseWriter, r *http.Request) {
+	isJSON := r.Header.Get("Content-Type") == "application/json"
+	login := loginDTO{}
+	if isJSON {
+		if err := json.NewDecoder(r.Body).Decode(&login); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		login.Username = r.PostForm.Get("username")
+		login.Password = r.PostForm.Get("password")
+		login.Token = r.PostForm.Get("token")
+	}
+	ok := false
+	if login.Username != "" {
+		ok = s.authenticator.CheckPassword(login.Username, login.Password)
+	} else if login.Token != "" {
+		ok = s.authenticator.CheckToken(login.Token)
+	}
+	if !ok {
+		slog.Warn("failed login", "username", login.Username, "remote", r.RemoteAddr)
+		if isJSON {
+			w.WriteHeader(http.StatusUnauthorized)
+		} else {
+			http.Redirect(w, r, "/login?failed", http.StatusSeeOther)
+		}
+		return
+	}
+	token, err := s.authenticator.NewSession()
+	if err != nil {
+		slog.Error("failed to create login session", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	slog.Info("login", "username", login.Username, "remote", r.RemoteAddr)
+	s.authenticator.SetSessionCookie(w, r, token)
+	if !isJSON {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(loginResponseDTO{Token: token})
+}
+
+func (s *SignalingThread) handleLogout(w http.ResponseWriter, r *http.Request) {
+	s.authenticator.EndSession(r)
+	s.authenticator.ClearSessionCookie(w)
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
@@ -0,0 +1,145 @@
+package signaling
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/3DRX/vaporplay/pairing"
+	"github.com/3DRX/vaporplay/signalingdto"
+)
+
+const pairPollInterval = 500 * time.Millisecond
+
+type approvePairingDTO struct {
+	PIN string `json:"pin"`
+}
+
+func isPIN(pin string) bool {
+	if len(pin) != 4 {
+		return false
+	}
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// handlePair records a pairing request and holds the request open until the
+// operator approves or rejects it, or it times out.
+func (s *SignalingThread) handlePair(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg().Auth.Pairing {
+		http.Error(w, "pairing is disabled", http.StatusNotFound)
+		return
+	}
+	req := signalingdto.PairRequestDTO{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" || len(req.Name) > 64 || len(req.Key) < 32 || !isPIN(req.PIN) {
+		http.Error(w, "invalid pairing request", http.StatusBadRequest)
+		return
+	}
+	addr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		addr = r.RemoteAddr
+	}
+	client, err := s.pairedClients.Request(req.Name, req.Key, req.PIN, addr)
+	switch {
+	case errors.Is(err, pairing.ErrPINInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, pairing.ErrTooManyPending):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	case err != nil:
+		slog.Error("failed to record pairing request", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	slog.Info("pairing requested, approve it with the PIN shown on the client", "client", client.Name, "id", client.ID)
+
+	ticker := time.NewTicker(pairPollInterval)
+	defer ticker.Stop()
+	timeout := time.After(pairing.RequestTimeout)
+	for {
+		select {
+		case <-r.Context().Done():
+			s.pairedClients.Revoke(client.ID)
+			return
+		case <-timeout:
+			s.pairedClients.Revoke(client.ID)
+			http.Error(w, "pairing request timed out", http.StatusRequestTimeout)
+			return
+		case <-ticker.C:
+		}
+		c, err := s.pairedClients.Get(client.ID)
+		if errors.Is(err, pairing.ErrUnknownClient) {
+			http.Error(w, "pairing request rejected", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			slog.Error("failed to read pairing request", "error", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if c.Paired() {
+			slog.Info("client paired", "client", c.Name, "id", c.ID)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(signalingdto.PairResponseDTO{ClientID: c.ID})
+			return
+		}
+	}
+}
+
+func (s *SignalingThread) handleListPairing(w http.ResponseWriter, r *http.Request) {
+	clients, err := s.pairedClients.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range clients {
+		clients[i].KeyHash = ""
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clients)
+}
+
+func (s *SignalingThread) handleApprovePairing(w http.ResponseWriter, r *http.Request) {
+	req := approvePairingDTO{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	client, err := s.pairedClients.Approve(req.PIN)
+	if errors.Is(err, pairing.ErrUnknownPIN) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	client.KeyHash = ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(client)
+}
+
+func (s *SignalingThread) handleRevokePairing(w http.ResponseWriter, r *http.Request) {
+	err := s.pairedClients.Revoke(r.PathValue("id"))
+	if errors.Is(err, pairing.ErrUnknownClient) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,66 +2,296 @@ package signaling
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"path"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/3DRX/vaporplay/config"
 	"github.com/3DRX/vaporplay/middleware"
+	"github.com/3DRX/vaporplay/pairing"
+	"github.com/3DRX/vaporplay/signalingdto"
 	"github.com/gorilla/websocket"
 	"github.com/pion/webrtc/v4"
 )
 
+const closeTimeout = time.Second
+
+// Receiver is a client connected to /webrtc that has asked for a session.
+// "Send" channels carry messages from the server to the client, "Recv"
+// channels carry messages from the client to the server.
+type Receiver struct {
+	// ID identifies the receiver and the session started for it.
+	ID                string
+	SessionConfig     *config.SessionConfig
+	SendSDPChan       chan webrtc.SessionDescription
+	RecvSDPChan       chan webrtc.SessionDescription
+	SendCandidateChan chan webrtc.ICECandidateInit
+	RecvCandidateChan chan webrtc.ICECandidateInit
+	SendStatsChan     chan signalingdto.StatsDTO
+	// EndWsPromise is closed when the client goes away.
+	EndWsPromise chan struct{}
+
+	// conn is nil for clients that signal over plain HTTP
+	conn         *websocket.Conn
+	version      int
+	connecting   bool
+	remoteOffers bool
+	outbox       chan *signalingdto.Message
+	byeReason    string
+	lastError    *signalingdto.ErrorDTO
+	errorLock    sync.Mutex
+	done         chan struct{}
+	sendDone     chan struct{}
+	endOnce      sync.Once
+	closeOnce    sync.Once
+	release      func()
+}
+
+func newSessionID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func newReceiver(conn *websocket.Conn, version int, release func()) *Receiver {
+	return &Receiver{
+		ID:                newSessionID(),
+		SendSDPChan:       make(chan webrtc.SessionDescription),
+		RecvSDPChan:       make(chan webrtc.SessionDescription),
+		SendCandidateChan: make(chan webrtc.ICECandidateInit),
+		RecvCandidateChan: make(chan webrtc.ICECandidateInit),
+		SendStatsChan:     make(chan signalingdto.StatsDTO),
+		EndWsPromise:      make(chan struct{}),
+		conn:              conn,
+		version:           version,
+		connecting:        false,
+		remoteOffers:      false,
+		outbox:            make(chan *signalingdto.Message, 8),
+		byeReason:         "session ended",
+		lastError:         nil,
+		done:              make(chan struct{}),
+		sendDone:          make(chan struct{}),
+		release:           release,
+	}
+}
+
+// RemoteOffers reports whether the client sends the offer and the session
+// answers it, instead of the other way around.
+func (r *Receiver) RemoteOffers() bool {
+	return r.remoteOffers
+}
+
+// CanRestartICE reports whether the client answers offers after the first
+// one. Legacy clients start over with a new peer connection on every offer.
+func (r *Receiver) CanRestartICE() bool {
+	return r.version != signalingdto.LegacyProtocolVersion && !r.remoteOffers
+}
+
+func (r *Receiver) end() {
+	r.endOnce.Do(func() {
+		close(r.EndWsPromise)
+	})
+}
+
+// Close says bye to the client, closes the websocket connection of the
+// receiver and removes it from the signaling thread. It is safe to call
+// more than once.
+func (r *Receiver) Close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		r.end()
+		close(r.done)
+		// let the send loop flush pending messages and the bye
+		select {
+		case <-r.sendDone:
+		case <-time.After(closeTimeout):
+		}
+		if r.conn != nil {
+			err = r.conn.Close()
+		}
+		r.release()
+	})
+	return err
+}
+
+// CloseWithError reports an error to the client before closing the receiver.
+func (r *Receiver) CloseWithError(code string, message string) error {
+	r.sendError(code, message)
+	return r.Close()
+}
+
+// CloseWithReason tells the client why the session ends before closing the
+// receiver.
+func (r *Receiver) CloseWithReason(reason string) error {
+	r.errorLock.Lock()
+	r.byeReason = reason
+	r.errorLock.Unlock()
+	return r.Close()
+}
+
+// LastError returns the last error reported to the client, if any.
+func (r *Receiver) LastError() *signalingdto.ErrorDTO {
+	r.errorLock.Lock()
+	defer r.errorLock.Unlock()
+	return r.lastError
+}
+
+func (r *Receiver) sendError(code string, message string) {
+	r.errorLock.Lock()
+	r.lastError = &signalingdto.ErrorDTO{
+		Code:    code,
+		Message: message,
+	}
+	r.errorLock.Unlock()
+	if r.version == signalingdto.LegacyProtocolVersion {
+		slog.Warn("can't report error to legacy client", "id", r.ID, "code", code, "message", message)
+		return
+	}
+	msg, err := signalingdto.NewMessage(signalingdto.TypeError, signalingdto.ErrorDTO{
+		Code:    code,
+		Message: message,
+	})
+	if err != nil {
+		slog.Error("failed to compose error message", "error", err)
+		return
+	}
+	select {
+	case r.outbox <- msg:
+	case <-r.done:
+	}
+}
+
+// SendICEServers advertises additional ICE servers to the client, it has to
+// be called before the offer is sent.
+func (r *Receiver) SendICEServers(servers []signalingdto.ICEServerDTO) error {
+	msg, err := signalingdto.NewMessage(signalingdto.TypeICEServers, signalingdto.ICEServersDTO{
+		Servers: servers,
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case r.outbox <- msg:
+	case <-r.done:
+	}
+	return nil
+}
+
+// write sends payload to the client, wrapped in an envelope of type t unless
+// the client speaks the legacy protocol.
+func (r *Receiver) write(t signalingdto.MessageType, payload interface{}) error {
+	var b []byte
+	var err error
+	if r.version == signalingdto.LegacyProtocolVersion {
+		switch t {
+		case signalingdto.TypeOffer, signalingdto.TypeAnswer, signalingdto.TypeCandidate:
+			b, err = json.Marshal(payload)
+		default:
+			// the legacy protocol has no such message
+			return nil
+		}
+	} else {
+		var msg *signalingdto.Message
+		msg, err = signalingdto.NewMessage(t, payload)
+		if err != nil {
+			return err
+		}
+		b, err = json.Marshal(msg)
+	}
+	if err != nil {
+		return err
+	}
+	return r.conn.WriteMessage(websocket.TextMessage, b)
+}
+
+func (r *Receiver) writeMessage(msg *signalingdto.Message) error {
+	if r.version == signalingdto.LegacyProtocolVersion {
+		return nil
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return r.conn.WriteMessage(websocket.TextMessage, b)
+}
+
 type SignalingThread struct {
-	cfg                 *config.Config
+	reloader            *config.Reloader
 	upgrader            *websocket.Upgrader
-	conn                *websocket.Conn
-	haveReceiverPromise chan *config.SessionConfig
-	sendSDPChan         <-chan webrtc.SessionDescription
-	recvSDPChan         chan<- webrtc.SessionDescription
-	sendCandidateChan   <-chan webrtc.ICECandidateInit
-	recvCandidateChan   chan<- webrtc.ICECandidateInit
-	connecting          bool
+	receivers           map[string]*Receiver
+	receiversLock       sync.Mutex
+	haveReceiverPromise chan *Receiver
 	httpServer          *http.Server
 	webuiDir            http.FileSystem
-	endWsPromise        chan<- struct{}
+	authenticator       *middleware.Authenticator
+	pairedClients       *pairing.Store
+	sessionAdmin        SessionAdmin
+	games               *config.GameCatalog
+	icons               *iconCache
 }
 
 func NewSignalingThread(
-	cfg *config.Config,
-	sendSDPChan <-chan webrtc.SessionDescription,
-	recvSDPChan chan<- webrtc.SessionDescription,
-	sendCandidateChan <-chan webrtc.ICECandidateInit,
-	recvCandidateChan chan<- webrtc.ICECandidateInit,
+	reloader *config.Reloader,
+	games *config.GameCatalog,
 	webuiDir http.FileSystem,
-	endWsPromise chan<- struct{},
+	pairedClients *pairing.Store,
+	sessionAdmin SessionAdmin,
 ) *SignalingThread {
-	return &SignalingThread{
-		cfg: cfg,
+	cfg := reloader.Config()
+	s := &SignalingThread{
+		reloader: reloader,
 		upgrader: &websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
-				return true
+				allowedOrigins := reloader.Config().AllowedOrigins
+				if _, err := r.Cookie(middleware.SessionCookieName); err == nil {
+					// browsers send the session cookie with websockets from any origin
+					return middleware.OriginTrusted(r, allowedOrigins)
+				}
+				return middleware.OriginAllowed(r, allowedOrigins)
 			},
+			Subprotocols: signalingdto.Subprotocols(),
 		},
-		conn:                nil,
-		haveReceiverPromise: make(chan *config.SessionConfig),
-		sendSDPChan:         sendSDPChan,
-		recvSDPChan:         recvSDPChan,
-		sendCandidateChan:   sendCandidateChan,
-		recvCandidateChan:   recvCandidateChan,
-		connecting:          false,
+		receivers:           map[string]*Receiver{},
+		haveReceiverPromise: make(chan *Receiver),
 		webuiDir:            webuiDir,
-		endWsPromise:        endWsPromise,
+		authenticator:       middleware.NewAuthenticator(&cfg.Auth, pairedClients),
+		pairedClients:       pairedClients,
+		sessionAdmin:        sessionAdmin,
+		games:               games,
+		icons:               newIconCache(cfg),
 	}
+	reloader.OnReload(func(cfg *config.Config) {
+		s.games.Replace(cfg.Games)
+		s.authenticator.SetConfig(&cfg.Auth)
+		s.icons.setConfig(cfg)
+	})
+	return s
 }
 
-func frontendHandler(sub http.FileSystem) http.Handler {
+// cfg returns the current config.
+func (s *SignalingThread) cfg() *config.Config {
+	return s.reloader.Config()
+}
+
+func frontendHandler(sub http.FileSystem, authenticator *middleware.Authenticator) http.Handler {
 	fs := http.FileServer(sub)
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authenticator.Authenticate(r) {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
 		if r.URL.Path == "/" {
 			fs.ServeHTTP(w, r)
 			return
@@ -77,10 +307,25 @@ func frontendHandler(sub http.FileSystem) http.Handler {
 	})
 }
 
-func (s *SignalingThread) Spin() <-chan *config.SessionConfig {
+// Spin starts the http server. Every client that connects to /webrtc and
+// sends a session config is delivered on the returned channel.
+func (s *SignalingThread) Spin() <-chan *Receiver {
 	mux := http.NewServeMux()
-	mux.Handle("GET /games", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		jsonGames, err := json.Marshal(s.cfg.Games)
+	authenticated := middleware.AuthMiddleware(s.authenticator)
+	operator := middleware.OperatorMiddleware(s.authenticator)
+	mux.Handle("GET /login", http.HandlerFunc(s.handleLoginPage))
+	mux.Handle("POST /login", http.HandlerFunc(s.handleLogin))
+	mux.Handle("POST /logout", http.HandlerFunc(s.handleLogout))
+	mux.Handle("POST /pair", http.HandlerFunc(s.handlePair))
+	mux.Handle("GET /admin/pairing", operator(http.HandlerFunc(s.handleListPairing)))
+	mux.Handle("POST /admin/pairing/approve", operator(http.HandlerFunc(s.handleApprovePairing)))
+	mux.Handle("DELETE /admin/pairing/{id}", operator(http.HandlerFunc(s.handleRevokePairing)))
+	mux.Handle("GET /admin/sessions", operator(http.HandlerFunc(s.handleListSessions)))
+	mux.Handle("GET /admin/sessions/{id}", operator(http.HandlerFunc(s.handleSessionStats)))
+	mux.Handle("DELETE /admin/sessions/{id}", operator(http.HandlerFunc(s.handleTerminateSession)))
+	mux.Handle("GET /admin/capabilities", operator(http.HandlerFunc(s.handleCapabilities)))
+	mux.Handle("GET /games", authenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jsonGames, err := json.Marshal(s.icons.withIcons(s.games.List()))
 		if err != nil {
 			slog.Error("failed to marshal games", "error", err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -88,105 +333,344 @@ func (s *SignalingThread) Spin() <-chan *config.SessionConfig {
 		}
 		w.Write(jsonGames)
 		return
-	}))
-	mux.Handle("GET /webrtc", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if s.conn != nil {
-			slog.Warn("already have a receiver, rejecting new connection")
-			w.WriteHeader(http.StatusConflict)
-			return
-		}
+	})))
+	mux.Handle("GET /games/{id}/icon", authenticated(http.HandlerFunc(s.handleGameIcon)))
+	mux.Handle("POST /games", operator(http.HandlerFunc(s.handleAddGame)))
+	mux.Handle("PUT /games/{id}", operator(http.HandlerFunc(s.handleUpdateGame)))
+	mux.Handle("DELETE /games/{id}", operator(http.HandlerFunc(s.handleRemoveGame)))
+	mux.Handle("GET /webrtc", authenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		conn, err := s.upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			slog.Error("failed to upgrade connection", "error", err)
 			return
 		}
-		slog.Info("new receiver connected")
-		s.conn = conn
-		s.conn.SetCloseHandler(func(code int, text string) error {
-			s.endWsPromise <- struct{}{}
+		version, err := signalingdto.ParseSubprotocol(conn.Subprotocol())
+		if err != nil {
+			slog.Error("failed to negotiate protocol version", "error", err)
+			conn.Close()
+			return
+		}
+		receiver := s.addReceiver(conn, version)
+		slog.Info("new receiver connected", "id", receiver.ID, "remote", r.RemoteAddr, "version", version)
+		conn.SetCloseHandler(func(code int, text string) error {
+			receiver.end()
 			return nil
 		})
-		go s.handleRecvMessages()
-		go s.handleSendMessages()
-	}))
-	mux.Handle("/", frontendHandler(s.webuiDir))
+		go s.handleRecvMessages(receiver)
+		go s.handleSendMessages(receiver)
+	})))
+	mux.Handle("POST /whep", authenticated(http.HandlerFunc(s.handleWHEPOffer)))
+	mux.Handle("PATCH /whep/{id}", authenticated(http.HandlerFunc(s.handleWHEPCandidates)))
+	mux.Handle("DELETE /whep/{id}", authenticated(http.HandlerFunc(s.handleWHEPDelete)))
+	mux.Handle("/", frontendHandler(s.webuiDir, s.authenticator))
 
 	httpServer := &http.Server{
-		Addr: s.cfg.Addr,
 		Handler: middleware.ChainMiddleware(
 			mux,
-			middleware.CORSMiddleware,
+			middleware.CORSMiddleware(func() []string {
+				return s.cfg().AllowedOrigins
+			}),
 		),
 	}
 	s.httpServer = httpServer
-	go func() {
-		err := httpServer.ListenAndServe()
-		if err != nil && err != http.ErrServerClosed {
+	cfg := s.cfg()
+	for _, addr := range cfg.ListenAddresses() {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
 			panic(err)
 		}
-	}()
+		slog.Info("listening", "addr", listener.Addr().String(), "tls", cfg.TLS.Enabled)
+		go func() {
+			var err error
+			if cfg.TLS.Enabled {
+				err = httpServer.ServeTLS(listener, cfg.TLS.CertFile, cfg.TLS.KeyFile)
+			} else {
+				err = httpServer.Serve(listener)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				panic(err)
+			}
+		}()
+	}
 	return s.haveReceiverPromise
 }
 
+// addReceiver registers a new receiver, it is removed again when closed.
+func (s *SignalingThread) addReceiver(conn *websocket.Conn, version int) *Receiver {
+	var receiver *Receiver
+	receiver = newReceiver(conn, version, func() {
+		s.receiversLock.Lock()
+		defer s.receiversLock.Unlock()
+		delete(s.receivers, receiver.ID)
+	})
+	s.receiversLock.Lock()
+	s.receivers[receiver.ID] = receiver
+	s.receiversLock.Unlock()
+	return receiver
+}
+
+func (s *SignalingThread) getReceiver(id string) (*Receiver, bool) {
+	s.receiversLock.Lock()
+	defer s.receiversLock.Unlock()
+	receiver, ok := s.receivers[id]
+	return receiver, ok
+}
+
 func (s *SignalingThread) Close() error {
+	return s.Shutdown(context.Background())
+}
+
+// Shutdown says bye to the clients that are still connected and stops the
+// http server, waiting for running requests until ctx is done.
+func (s *SignalingThread) Shutdown(ctx context.Context) error {
 	if s.httpServer != nil {
-		if s.conn != nil {
-			if err := s.conn.Close(); err != nil {
-				return err
+		s.receiversLock.Lock()
+		receivers := make([]*Receiver, 0, len(s.receivers))
+		for _, receiver := range s.receivers {
+			receivers = append(receivers, receiver)
+		}
+		s.receiversLock.Unlock()
+		for _, receiver := range receivers {
+			if err := receiver.CloseWithReason("server is shutting down"); err != nil {
+				slog.Warn("failed to close receiver", "error", err)
 			}
 		}
-		return s.httpServer.Shutdown(context.Background())
+		return s.httpServer.Shutdown(ctx)
 	}
 	return nil
 }
 
-func (s *SignalingThread) handleSendMessages() {
+func sdpMessageType(sdp webrtc.SessionDescription) signalingdto.MessageType {
+	if sdp.Type == webrtc.SDPTypeAnswer {
+		return signalingdto.TypeAnswer
+	}
+	return signalingdto.TypeOffer
+}
+
+func (s *SignalingThread) handleSendMessages(r *Receiver) {
+	defer close(r.sendDone)
 	for {
 		select {
-		case sdp := <-s.sendSDPChan:
-			jsonMsg, err := json.Marshal(sdp)
-			if err != nil {
-				slog.Error("failed to marshal SDP", "error", err)
+		case <-r.done:
+			r.flush()
+			return
+		case msg := <-r.outbox:
+			if err := r.writeMessage(msg); err != nil {
+				slog.Error("websocket write error", "error", err)
 			}
-			err = s.conn.WriteMessage(websocket.TextMessage, jsonMsg)
-			if err != nil {
+		case sdp := <-r.SendSDPChan:
+			// messages queued before the offer must arrive before it
+			r.drainOutbox()
+			if err := r.write(sdpMessageType(sdp), sdp); err != nil {
 				slog.Error("websocket write error", "error", err)
 			}
 			slog.Info("sent SDP", "sdp", sdp.SDP)
-		case candidate := <-s.sendCandidateChan:
-			jsonMsg, err := json.Marshal(candidate)
-			if err != nil {
-				slog.Error("failed to marshal ICE candidate", "error", err)
-			}
-			err = s.conn.WriteMessage(websocket.TextMessage, jsonMsg)
-			if err != nil {
+		case candidate := <-r.SendCandidateChan:
+			if err := r.write(signalingdto.TypeCandidate, candidate); err != nil {
 				slog.Error("websocket write error", "error", err)
 			}
 			slog.Info("sent ICE candidate", "candidate", candidate)
+		case stats := <-r.SendStatsChan:
+			if err := r.write(signalingdto.TypeStats, stats); err != nil {
+				slog.Error("websocket write error", "error", err)
+			}
+		}
+	}
+}
+
+// drainOutbox writes the queued messages.
+func (r *Receiver) drainOutbox() {
+	for {
+		select {
+		case msg := <-r.outbox:
+			if err := r.writeMessage(msg); err != nil {
+				slog.Error("websocket write error", "error", err)
+			}
+			continue
+		default:
+		}
+		break
+	}
+}
+
+// flush writes the queued messages, then says bye.
+func (r *Receiver) flush() {
+	r.drainOutbox()
+	r.errorLock.Lock()
+	reason := r.byeReason
+	r.errorLock.Unlock()
+	if err := r.write(signalingdto.TypeBye, signalingdto.ByeDTO{Reason: reason}); err != nil {
+		slog.Debug("failed to say bye", "error", err)
+	}
+}
+
+// resolveSessionConfig looks the requested game up in the catalog by its
+// game_id, only the codec config is taken from the client and what it
+// leaves out comes from the default codec config.
+func (s *SignalingThread) resolveSessionConfig(requested *config.SessionConfig) (*config.SessionConfig, error) {
+	gameId := requested.GameConfig.GameId
+	if gameId == "" {
+		return nil, fmt.Errorf("game_config.game_id is required")
+	}
+	game, ok := s.games.Get(gameId)
+	if !ok {
+		return nil, fmt.Errorf("unknown game_id %q", gameId)
+	}
+	sessionConfig := &config.SessionConfig{
+		GameConfig:  game,
+		CodecConfig: requested.CodecConfig,
+	}
+	sessionConfig.CodecConfig.FillFrom(s.cfg().DefaultCodec)
+	if err := config.CheckSessionConfig(sessionConfig); err != nil {
+		return nil, err
+	}
+	return sessionConfig, nil
+}
+
+func (s *SignalingThread) handleRecvMessages(r *Receiver) {
+	handedOff := false
+	defer func() {
+		if handedOff {
+			r.end()
+			return
+		}
+		// nobody else owns the receiver yet, clean it up here
+		r.Close()
+	}()
+	if r.version == signalingdto.LegacyProtocolVersion {
+		s.handleLegacyRecvMessages(r, &handedOff)
+		return
+	}
+	for {
+		_, raw, err := r.conn.ReadMessage()
+		if err != nil {
+			slog.Error("websocket read error", "error", err)
+			r.conn.Close()
+			return
+		}
+		msg := &signalingdto.Message{}
+		if err := json.Unmarshal(raw, msg); err != nil {
+			r.sendError(signalingdto.ErrorCodeBadMessage, err.Error())
+			continue
+		}
+		switch msg.Type {
+		case signalingdto.TypeSessionRequest:
+			if r.SessionConfig != nil {
+				r.sendError(signalingdto.ErrorCodeUnexpectedType, "session already requested")
+				continue
+			}
+			sessionConfig := &config.SessionConfig{}
+			if err := msg.Decode(sessionConfig); err != nil {
+				r.sendError(signalingdto.ErrorCodeBadMessage, err.Error())
+				continue
+			}
+			sessionConfig, err = s.resolveSessionConfig(sessionConfig)
+			if err != nil {
+				r.sendError(signalingdto.ErrorCodeInvalidSessionConfig, err.Error())
+				continue
+			}
+			r.SessionConfig = sessionConfig
+			select {
+			case s.haveReceiverPromise <- r:
+				handedOff = true
+			case <-r.done:
+				return
+			}
+		case signalingdto.TypeAnswer:
+			if !handedOff {
+				r.sendError(signalingdto.ErrorCodeUnexpectedType, "answer before session request")
+				continue
+			}
+			answer := webrtc.SessionDescription{}
+			if err := msg.Decode(&answer); err != nil || answer.Type != webrtc.SDPTypeAnswer {
+				r.sendError(signalingdto.ErrorCodeBadMessage, "invalid answer")
+				continue
+			}
+			slog.Info("received SDP", "sdp", answer.SDP)
+			select {
+			case r.RecvSDPChan <- answer:
+			case <-r.done:
+				return
+			}
+		case signalingdto.TypeCandidate:
+			if !handedOff {
+				r.sendError(signalingdto.ErrorCodeUnexpectedType, "candidate before session request")
+				continue
+			}
+			candidate := webrtc.ICECandidateInit{}
+			if err := msg.Decode(&candidate); err != nil {
+				r.sendError(signalingdto.ErrorCodeBadMessage, err.Error())
+				continue
+			}
+			slog.Info("received ICE candidate", "candidate", candidate)
+			select {
+			case r.RecvCandidateChan <- candidate:
+			case <-r.done:
+				return
+			}
+		case signalingdto.TypeBye:
+			bye := signalingdto.ByeDTO{}
+			msg.Decode(&bye)
+			slog.Info("receiver said bye", "id", r.ID, "reason", bye.Reason)
+			return
+		case signalingdto.TypeError:
+			clientErr := signalingdto.ErrorDTO{}
+			msg.Decode(&clientErr)
+			slog.Warn("receiver reported error", "id", r.ID, "code", clientErr.Code, "message", clientErr.Message)
+		case signalingdto.TypeStats:
+			slog.Debug("receiver stats", "id", r.ID, "stats", string(msg.Payload))
+		default:
+			r.sendError(signalingdto.ErrorCodeUnexpectedType, "unexpected message type "+string(msg.Type))
 		}
 	}
 }
 
-func (s *SignalingThread) handleRecvMessages() {
+// handleLegacyRecvMessages reads frames of the untyped protocol: a session
+// config followed by an SDP answer and ICE candidates.
+func (s *SignalingThread) handleLegacyRecvMessages(r *Receiver, handedOff *bool) {
 	for {
-		_, message, err := s.conn.ReadMessage()
+		_, message, err := r.conn.ReadMessage()
 		if err != nil {
 			slog.Error("websocket read error", "error", err)
-			s.conn.Close()
+			r.conn.Close()
 			return
 		}
+		if r.connecting {
+			candidate := webrtc.ICECandidateInit{}
+			if err := json.Unmarshal(message, &candidate); err == nil && candidate.Candidate != "" {
+				slog.Info("received ICE candidate", "candidate", candidate)
+				select {
+				case r.RecvCandidateChan <- candidate:
+				case <-r.done:
+					return
+				}
+				continue
+			}
+		}
 		selectedGame := &config.SessionConfig{}
 		err = json.Unmarshal(message, selectedGame)
 		if err != nil {
-			s.connecting = false
+			r.connecting = false
 			continue
 		}
-		if !s.connecting {
-			s.haveReceiverPromise <- selectedGame
-			_, message, err = s.conn.ReadMessage()
+		if !r.connecting {
+			selectedGame, err = s.resolveSessionConfig(selectedGame)
+			if err != nil {
+				slog.Warn("invalid session config from legacy client", "id", r.ID, "error", err)
+				return
+			}
+			r.SessionConfig = selectedGame
+			r.connecting = true
+			select {
+			case s.haveReceiverPromise <- r:
+				*handedOff = true
+			case <-r.done:
+				return
+			}
+			_, message, err = r.conn.ReadMessage()
 			if err != nil {
 				slog.Error("websocket read error", "error", err)
-				s.conn.Close()
+				r.conn.Close()
 				return
 			}
 			// try to parse it as an SDP
@@ -197,7 +681,11 @@ func (s *SignalingThread) handleRecvMessages() {
 				continue
 			}
 			slog.Info("received SDP", "sdp", newSDP.SDP)
-			s.recvSDPChan <- newSDP
+			select {
+			case r.RecvSDPChan <- newSDP:
+			case <-r.done:
+				return
+			}
 		}
 	}
 }
@@ -0,0 +1,244 @@
+package signaling
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/3DRX/vaporplay/config"
+	"github.com/3DRX/vaporplay/signalingdto"
+	"github.com/pion/webrtc/v4"
+)
+
+// HTTP signaling modelled on WHEP: the client POSTs an SDP offer to /whep
+// and gets the answer back together with a session resource at
+// /whep/{id}. Candidates are trickled with PATCH, DELETE ends the session.
+// The answer carries all of our candidates, since there is no way to
+// trickle them to the client.
+
+const (
+	maxSDPSize         = 1 << 20
+	contentTypeSDP     = "application/sdp"
+	contentTypeSDPFrag = "application/trickle-ice-sdpfrag"
+)
+
+func hasContentType(r *http.Request, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == contentType
+}
+
+// sessionConfigFromQuery builds a session config from the query parameters
+// of a WHEP request. The game is picked from the configured games by
+// game_id, codec, frame_rate, initial_bitrate and max_bitrate are optional.
+func sessionConfigFromQuery(cfg *config.Config, games *config.GameCatalog, query url.Values) (*config.SessionConfig, error) {
+	gameId := query.Get("game_id")
+	if gameId == "" {
+		return nil, fmt.Errorf("game_id is required")
+	}
+	sessionConfig := &config.SessionConfig{
+		CodecConfig: cfg.DefaultCodec,
+	}
+	game, ok := games.Get(gameId)
+	if !ok {
+		return nil, fmt.Errorf("unknown game_id %q", gameId)
+	}
+	sessionConfig.GameConfig = game
+	if codec := query.Get("codec"); codec != "" {
+		sessionConfig.CodecConfig.Codec = codec
+	}
+	if frameRate := query.Get("frame_rate"); frameRate != "" {
+		v, err := strconv.ParseFloat(frameRate, 32)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("invalid frame_rate %q", frameRate)
+		}
+		sessionConfig.CodecConfig.FrameRate = float32(v)
+	}
+	if initialBitrate := query.Get("initial_bitrate"); initialBitrate != "" {
+		v, err := strconv.Atoi(initialBitrate)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("invalid initial_bitrate %q", initialBitrate)
+		}
+		sessionConfig.CodecConfig.InitialBitrate = v
+	}
+	if maxBitrate := query.Get("max_bitrate"); maxBitrate != "" {
+		v, err := strconv.Atoi(maxBitrate)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("invalid max_bitrate %q", maxBitrate)
+		}
+		sessionConfig.CodecConfig.MaxBitrate = v
+	}
+	if err := config.CheckSessionConfig(sessionConfig); err != nil {
+		return nil, err
+	}
+	return sessionConfig, nil
+}
+
+// parseSDPFrag extracts the candidates of a trickle ICE SDP fragment
+// (RFC 8840). a=end-of-candidates becomes an empty candidate.
+func parseSDPFrag(frag string) []webrtc.ICECandidateInit {
+	candidates := []webrtc.ICECandidateInit{}
+	var mid *string
+	var mLineIndex *uint16
+	nextMLineIndex := uint16(0)
+	for _, line := range strings.Split(frag, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "m="):
+			index := nextMLineIndex
+			mLineIndex = &index
+			mid = nil
+			nextMLineIndex++
+		case strings.HasPrefix(line, "a=mid:"):
+			v := strings.TrimPrefix(line, "a=mid:")
+			mid = &v
+		case strings.HasPrefix(line, "a=candidate:"):
+			if strings.TrimPrefix(line, "a=candidate:") == "" {
+				continue
+			}
+			candidates = append(candidates, webrtc.ICECandidateInit{
+				Candidate:     strings.TrimPrefix(line, "a="),
+				SDPMid:        mid,
+				SDPMLineIndex: mLineIndex,
+			})
+		case line == "a=end-of-candidates":
+			candidates = append(candidates, webrtc.ICECandidateInit{})
+		}
+	}
+	return candidates
+}
+
+// handleWHEPSendMessages drains what a session sends to an HTTP client. The
+// answer is picked up by handleWHEPOffer, our candidates are already part
+// of it and there is no way to deliver anything else.
+func (s *SignalingThread) handleWHEPSendMessages(r *Receiver) {
+	defer close(r.sendDone)
+	for {
+		select {
+		case <-r.done:
+			return
+		case msg := <-r.outbox:
+			slog.Debug("dropping message to HTTP receiver", "id", r.ID, "type", msg.Type)
+		case <-r.SendCandidateChan:
+		case <-r.SendStatsChan:
+		}
+	}
+}
+
+func (s *SignalingThread) handleWHEPOffer(w http.ResponseWriter, r *http.Request) {
+	if !hasContentType(r, contentTypeSDP) {
+		http.Error(w, "content type must be "+contentTypeSDP, http.StatusUnsupportedMediaType)
+		return
+	}
+	sessionConfig, err := sessionConfigFromQuery(s.cfg(), s.games, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSDPSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offer := webrtc.SessionDescription{
+		Type: webrtc.SDPTypeOffer,
+		SDP:  string(body),
+	}
+	if _, err := offer.Unmarshal(); err != nil {
+		http.Error(w, "invalid offer: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	receiver := s.addReceiver(nil, signalingdto.ProtocolVersion)
+	receiver.SessionConfig = sessionConfig
+	receiver.remoteOffers = true
+	slog.Info("new HTTP receiver", "id", receiver.ID, "remote", r.RemoteAddr)
+	go s.handleWHEPSendMessages(receiver)
+	select {
+	case s.haveReceiverPromise <- receiver:
+	case <-r.Context().Done():
+		receiver.Close()
+		return
+	}
+
+	var answer webrtc.SessionDescription
+	select {
+	case receiver.RecvSDPChan <- offer:
+	case <-receiver.EndWsPromise:
+		writeSessionError(w, receiver)
+		return
+	case <-r.Context().Done():
+		receiver.end()
+		return
+	}
+	select {
+	case answer = <-receiver.SendSDPChan:
+	case <-receiver.EndWsPromise:
+		writeSessionError(w, receiver)
+		return
+	case <-r.Context().Done():
+		receiver.end()
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeSDP)
+	w.Header().Set("Location", "/whep/"+receiver.ID)
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, answer.SDP)
+}
+
+// writeSessionError responds with the error that ended the session before
+// an answer was produced.
+func writeSessionError(w http.ResponseWriter, receiver *Receiver) {
+	sessionErr := receiver.LastError()
+	if sessionErr == nil {
+		http.Error(w, "session ended", http.StatusInternalServerError)
+		return
+	}
+	status := http.StatusInternalServerError
+	if sessionErr.Code == signalingdto.ErrorCodeSessionRejected {
+		status = http.StatusConflict
+	}
+	http.Error(w, sessionErr.Message, status)
+}
+
+func (s *SignalingThread) handleWHEPCandidates(w http.ResponseWriter, r *http.Request) {
+	receiver, ok := s.getReceiver(r.PathValue("id"))
+	if !ok || !receiver.remoteOffers {
+		http.NotFound(w, r)
+		return
+	}
+	if !hasContentType(r, contentTypeSDPFrag) {
+		http.Error(w, "content type must be "+contentTypeSDPFrag, http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSDPSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, candidate := range parseSDPFrag(string(body)) {
+		slog.Info("received ICE candidate", "id", receiver.ID, "candidate", candidate.Candidate)
+		select {
+		case receiver.RecvCandidateChan <- candidate:
+		case <-receiver.EndWsPromise:
+			http.NotFound(w, r)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *SignalingThread) handleWHEPDelete(w http.ResponseWriter, r *http.Request) {
+	receiver, ok := s.getReceiver(r.PathValue("id"))
+	if !ok || !receiver.remoteOffers {
+		http.NotFound(w, r)
+		return
+	}
+	slog.Info("HTTP receiver ended the session", "id", receiver.ID)
+	receiver.end()
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,175 @@
+package signaling
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/3DRX/vaporplay/config"
+	"github.com/pion/webrtc/v4"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestParseSDPFrag(t *testing.T) {
+	tests := []struct {
+		name       string
+		frag       string
+		candidates []webrtc.ICECandidateInit
+	}{
+		{
+			// RFC 9725 section 4.3.1
+			name: "single media section",
+			frag: strings.ReplaceAll(`a=ice-ufrag:EsAw
+a=ice-pwd:P2uYro0UCOQ4zxjKXaWCBui1
+m=audio 9 RTP/AVP 0
+a=mid:0
+a=candidate:1387637174 1 udp 2122260223 192.0.2.1 61764 typ host generation 0 ufrag EsAw network-id 1
+a=candidate:3471623853 1 udp 2122194687 198.51.100.2 61765 typ host generation 0 ufrag EsAw network-id 2
+a=candidate:473322822 1 tcp 1518280447 192.0.2.1 9 typ host tcptype active generation 0 ufrag EsAw network-id 1
+a=end-of-candidates
+`, "\n", "\r\n"),
+			candidates: []webrtc.ICECandidateInit{
+				{
+					Candidate:     "candidate:1387637174 1 udp 2122260223 192.0.2.1 61764 typ host generation 0 ufrag EsAw network-id 1",
+					SDPMid:        ptr("0"),
+					SDPMLineIndex: ptr(uint16(0)),
+				},
+				{
+					Candidate:     "candidate:3471623853 1 udp 2122194687 198.51.100.2 61765 typ host generation 0 ufrag EsAw network-id 2",
+					SDPMid:        ptr("0"),
+					SDPMLineIndex: ptr(uint16(0)),
+				},
+				{
+					Candidate:     "candidate:473322822 1 tcp 1518280447 192.0.2.1 9 typ host tcptype active generation 0 ufrag EsAw network-id 1",
+					SDPMid:        ptr("0"),
+					SDPMLineIndex: ptr(uint16(0)),
+				},
+				{},
+			},
+		},
+		{
+			name: "several media sections",
+			frag: `a=ice-ufrag:EsAw
+a=ice-pwd:P2uYro0UCOQ4zxjKXaWCBui1
+m=video 9 UDP/TLS/RTP/SAVPF 96
+a=mid:video
+a=candidate:1 1 udp 2122260223 192.0.2.1 61764 typ host
+m=application 9 UDP/DTLS/SCTP webrtc-datachannel
+a=candidate:2 1 udp 1686052607 203.0.113.7 50000 typ srflx raddr 192.0.2.1 rport 61764
+a=mid:data
+`,
+			candidates: []webrtc.ICECandidateInit{
+				{
+					Candidate:     "candidate:1 1 udp 2122260223 192.0.2.1 61764 typ host",
+					SDPMid:        ptr("video"),
+					SDPMLineIndex: ptr(uint16(0)),
+				},
+				{
+					// the mid of a media section comes after the candidate
+					Candidate:     "candidate:2 1 udp 1686052607 203.0.113.7 50000 typ srflx raddr 192.0.2.1 rport 61764",
+					SDPMLineIndex: ptr(uint16(1)),
+				},
+			},
+		},
+		{
+			name: "no media section",
+			frag: "a=candidate:1 1 udp 2122260223 192.0.2.1 61764 typ host\n",
+			candidates: []webrtc.ICECandidateInit{
+				{Candidate: "candidate:1 1 udp 2122260223 192.0.2.1 61764 typ host"},
+			},
+		},
+		{
+			name:       "empty",
+			frag:       "",
+			candidates: []webrtc.ICECandidateInit{},
+		},
+		{
+			name: "malformed",
+			frag: `garbage
+m=
+a=candidate:
+a=candidate
+a=end-of-candidates-please
+a=mid:
+`,
+			candidates: []webrtc.ICECandidateInit{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			candidates := parseSDPFrag(test.frag)
+			if !reflect.DeepEqual(candidates, test.candidates) {
+				t.Errorf("got candidates %+v, want %+v", candidates, test.candidates)
+			}
+		})
+	}
+}
+
+func TestSessionConfigFromQuery(t *testing.T) {
+	cfg := &config.Config{
+		DefaultCodec: config.CodecConfig{
+			Codec:          "h264_nvenc",
+			FrameRate:      60,
+			InitialBitrate: 5_000_000,
+			MaxBitrate:     30_000_000,
+		},
+	}
+	games := config.NewGameCatalog("", []config.GameConfig{
+		{GameId: "1", GameWindowName: "One", GameDisplayName: "One"},
+	})
+	tests := []struct {
+		name  string
+		query string
+		codec *config.CodecConfig
+	}{
+		{
+			name:  "defaults",
+			query: "game_id=1",
+			codec: &cfg.DefaultCodec,
+		},
+		{
+			name:  "codec config",
+			query: "game_id=1&codec=libx264&frame_rate=30&initial_bitrate=2000000&max_bitrate=8000000",
+			codec: &config.CodecConfig{
+				Codec:          "libx264",
+				FrameRate:      30,
+				InitialBitrate: 2_000_000,
+				MaxBitrate:     8_000_000,
+			},
+		},
+		{name: "missing game", query: "codec=libx264"},
+		{name: "unknown game", query: "game_id=2"},
+		{name: "game name instead of id", query: "game_id=One"},
+		{name: "unknown codec", query: "game_id=1&codec=vp8"},
+		{name: "negative frame rate", query: "game_id=1&frame_rate=-1"},
+		{name: "frame rate not a number", query: "game_id=1&frame_rate=fast"},
+		{name: "bitrate not an integer", query: "game_id=1&initial_bitrate=2.5e6"},
+		{name: "initial bitrate above max", query: "game_id=1&initial_bitrate=40000000"},
+		{name: "zero max bitrate", query: "game_id=1&max_bitrate=0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sessionConfig, err := sessionConfigFromQuery(cfg, games, query)
+			if test.codec == nil {
+				if err == nil {
+					t.Errorf("got session config %+v, want an error", sessionConfig)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sessionConfig.GameConfig.GameId != "1" || sessionConfig.CodecConfig != *test.codec {
+				t.Errorf("got session config %+v, want game 1 with %+v", sessionConfig, *test.codec)
+			}
+		})
+	}
+}
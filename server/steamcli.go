@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/3DRX/vaporplay/config"
+	"github.com/3DRX/vaporplay/steam"
+)
+
+// importSteamGames adds the games of the Steam library at root that aren't
+// in the catalog yet, root defaults to the local Steam installation.
+func importSteamGames(games *config.GameCatalog, root string) ([]config.GameConfig, error) {
+	if root == "" {
+		root = steam.DefaultRoot()
+	}
+	if root == "" {
+		return nil, errors.New("no steam installation found, set the steam root")
+	}
+	imported, err := steam.NewImporter().Import(root)
+	if err != nil {
+		return nil, err
+	}
+	added := []config.GameConfig{}
+	for _, game := range imported {
+		if _, ok := games.Get(game.GameId); ok {
+			continue
+		}
+		if err := games.Add(game); err != nil {
+			return added, err
+		}
+		slog.Info("imported steam game", "game", game.GameId, "name", game.GameDisplayName)
+		added = append(added, game)
+	}
+	return added, nil
+}
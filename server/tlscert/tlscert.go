@@ -0,0 +1,115 @@
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"time"
+
+	"github.com/3DRX/vaporplay/config"
+)
+
+const selfSignedValidity = 10 * 365 * 24 * time.Hour
+
+// Prepare generates the self-signed certificate on first run and checks
+// that the certificate and key can be loaded. It returns the fingerprint
+// of the certificate, which clients can pin.
+func Prepare(cfg *config.Config) (string, error) {
+	c := &cfg.TLS
+	if c.SelfSigned {
+		_, certErr := os.Stat(c.CertFile)
+		_, keyErr := os.Stat(c.KeyFile)
+		if errors.Is(certErr, os.ErrNotExist) && errors.Is(keyErr, os.ErrNotExist) {
+			if err := generate(c, cfg.Addr); err != nil {
+				return "", err
+			}
+			slog.Info("generated self-signed certificate", "cert", c.CertFile, "key", c.KeyFile)
+		}
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return "", err
+	}
+	return config.CertFingerprint(cert.Certificate[0]), nil
+}
+
+// hosts returns the names and addresses a self-signed certificate is
+// valid for.
+func hosts(c *config.TLSConfig, addr string) ([]string, []net.IP) {
+	dnsNames := []string{"localhost"}
+	ips := []net.IP{}
+	add := func(host string) {
+		if host == "" {
+			return
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			if !ip.IsUnspecified() {
+				ips = append(ips, ip)
+			}
+			return
+		}
+		dnsNames = append(dnsNames, host)
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		add(hostname)
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil && host != "localhost" {
+		add(host)
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			if ipNet, ok := a.(*net.IPNet); ok {
+				ips = append(ips, ipNet.IP)
+			}
+		}
+	}
+	for _, host := range c.Hosts {
+		add(host)
+	}
+	return dnsNames, ips
+}
+
+func generate(c *config.TLSConfig, addr string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	dnsNames, ips := hosts(c, addr)
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"VaporPlay"}, CommonName: dnsNames[len(dnsNames)-1]},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              dnsNames,
+		IPAddresses:           ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(c.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(c.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
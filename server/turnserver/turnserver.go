@@ -0,0 +1,117 @@
+package turnserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/3DRX/vaporplay/config"
+	"github.com/3DRX/vaporplay/signalingdto"
+	"github.com/pion/turn/v4"
+)
+
+const realm = "vaporplay"
+
+// TURNServer relays media for clients that can't reach the server directly.
+// Every session gets its own time limited credentials in the TURN REST API
+// format "<expiry>:<session id>", which stop working when the session ends.
+type TURNServer struct {
+	cfg      *config.TURNConfig
+	secret   string
+	server   *turn.Server
+	sessions map[string]struct{}
+	lock     sync.Mutex
+}
+
+func NewTURNServer(cfg *config.Config) (*TURNServer, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	t := &TURNServer{
+		cfg:      &cfg.TURN,
+		secret:   hex.EncodeToString(b),
+		sessions: map[string]struct{}{},
+	}
+	udpListener, err := net.ListenPacket("udp4", "0.0.0.0:"+strconv.Itoa(int(cfg.TURN.Port)))
+	if err != nil {
+		return nil, err
+	}
+	restAuthHandler := turn.LongTermTURNRESTAuthHandler(t.secret, nil)
+	server, err := turn.NewServer(turn.ServerConfig{
+		Realm: realm,
+		AuthHandler: func(username string, realm string, srcAddr net.Addr) ([]byte, bool) {
+			_, sessionID, ok := strings.Cut(username, ":")
+			if !ok || !t.isActive(sessionID) {
+				slog.Warn("rejected TURN credentials", "username", username, "remote", srcAddr)
+				return nil, false
+			}
+			return restAuthHandler(username, realm, srcAddr)
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &turn.RelayAddressGeneratorPortRange{
+					RelayAddress: net.ParseIP(cfg.TURN.PublicIP),
+					Address:      "0.0.0.0",
+					MinPort:      cfg.EphemeralUDPPortMin,
+					MaxPort:      cfg.EphemeralUDPPortMax,
+				},
+			},
+		},
+	})
+	if err != nil {
+		udpListener.Close()
+		return nil, err
+	}
+	t.server = server
+	slog.Info("TURN server listening", "port", cfg.TURN.Port, "public ip", cfg.TURN.PublicIP)
+	return t, nil
+}
+
+func (t *TURNServer) isActive(sessionID string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	_, ok := t.sessions[sessionID]
+	return ok
+}
+
+// Credentials issues credentials for a session, they are valid until
+// Revoke is called or they expire.
+func (t *TURNServer) Credentials(sessionID string) (signalingdto.ICEServerDTO, error) {
+	username, password, err := turn.GenerateLongTermTURNRESTCredentials(
+		t.secret,
+		sessionID,
+		time.Duration(t.cfg.CredentialTTL)*time.Second,
+	)
+	if err != nil {
+		return signalingdto.ICEServerDTO{}, err
+	}
+	t.lock.Lock()
+	t.sessions[sessionID] = struct{}{}
+	t.lock.Unlock()
+	return signalingdto.ICEServerDTO{
+		URLs: []string{
+			fmt.Sprintf("turn:%s?transport=udp", net.JoinHostPort(t.cfg.PublicIP, strconv.Itoa(int(t.cfg.Port)))),
+		},
+		Username:   username,
+		Credential: password,
+	}, nil
+}
+
+// Revoke invalidates the credentials of a session.
+func (t *TURNServer) Revoke(sessionID string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.sessions, sessionID)
+}
+
+func (t *TURNServer) Close() error {
+	return t.server.Close()
+}
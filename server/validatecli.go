@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/3DRX/vaporplay/config"
+)
+
+// printConfigError prints every problem of an invalid config on its own
+// line.
+func printConfigError(configPath string, err error) {
+	var validationError *config.ValidationError
+	if !errors.As(err, &validationError) {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", configPath, err)
+		return
+	}
+	for _, fieldError := range validationError.Errors {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", configPath, fieldError)
+	}
+}
+
+// validateConfig checks the config file without starting the server.
+func validateConfig(configPath string) error {
+	b, err := os.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+	_, err = config.ParseCfg(b, configPath, overrides)
+	return err
+}
@@ -0,0 +1,156 @@
+// Package signalingdto defines the messages exchanged over the /webrtc
+// websocket between the server and its clients, and the bodies of the
+// HTTP endpoints clients use before connecting to it.
+//
+// The protocol version is negotiated with the websocket subprotocol: a client
+// offers Subprotocol(v) for every version it speaks and the server picks the
+// highest one it supports. A client that offers no subprotocol speaks version
+// 0, the legacy protocol where frames are bare JSON objects.
+package signalingdto
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ProtocolVersion is the latest protocol version.
+const ProtocolVersion = 1
+
+// LegacyProtocolVersion is the untyped protocol used before the envelope.
+const LegacyProtocolVersion = 0
+
+const subprotocolPrefix = "vaporplay.v"
+
+// Subprotocol returns the websocket subprotocol name of a protocol version.
+func Subprotocol(version int) string {
+	return subprotocolPrefix + strconv.Itoa(version)
+}
+
+// Subprotocols lists the subprotocols of every enveloped protocol version,
+// newest first.
+func Subprotocols() []string {
+	subprotocols := make([]string, 0, ProtocolVersion)
+	for v := ProtocolVersion; v > LegacyProtocolVersion; v-- {
+		subprotocols = append(subprotocols, Subprotocol(v))
+	}
+	return subprotocols
+}
+
+// ParseSubprotocol returns the protocol version of a negotiated subprotocol.
+// An empty subprotocol means the legacy protocol.
+func ParseSubprotocol(subprotocol string) (int, error) {
+	if subprotocol == "" {
+		return LegacyProtocolVersion, nil
+	}
+	if !strings.HasPrefix(subprotocol, subprotocolPrefix) {
+		return 0, fmt.Errorf("unknown subprotocol %q", subprotocol)
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(subprotocol, subprotocolPrefix))
+	if err != nil || version <= LegacyProtocolVersion || version > ProtocolVersion {
+		return 0, fmt.Errorf("unsupported subprotocol %q", subprotocol)
+	}
+	return version, nil
+}
+
+type MessageType string
+
+const (
+	// TypeSessionRequest is sent by the client to start a session, the
+	// payload is a config.SessionConfig.
+	TypeSessionRequest MessageType = "session-request"
+	// TypeOffer carries a webrtc.SessionDescription of type offer. The
+	// server sends a new offer to restart ICE when connectivity drops.
+	TypeOffer MessageType = "offer"
+	// TypeAnswer carries a webrtc.SessionDescription of type answer.
+	TypeAnswer MessageType = "answer"
+	// TypeCandidate carries a webrtc.ICECandidateInit. Both sides trickle
+	// their candidates, a candidate with an empty candidate string marks
+	// the end of candidates.
+	TypeCandidate MessageType = "candidate"
+	// TypeError carries an ErrorDTO.
+	TypeError MessageType = "error"
+	// TypeBye ends the session, the payload is a ByeDTO.
+	TypeBye MessageType = "bye"
+	// TypeStats carries a StatsDTO.
+	TypeStats MessageType = "stats"
+	// TypeICEServers carries an ICEServersDTO with ICE servers the client
+	// should use in addition to its own, it is sent before the offer.
+	TypeICEServers MessageType = "ice-servers"
+)
+
+// Message is the envelope of every websocket frame.
+type Message struct {
+	Type    MessageType     `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type ErrorDTO struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type ByeDTO struct {
+	Reason string `json:"reason"`
+}
+
+type ICEServerDTO struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+type ICEServersDTO struct {
+	Servers []ICEServerDTO `json:"servers"`
+}
+
+// StatsDTO is a snapshot of session statistics, such as the bandwidth
+// estimator state.
+type StatsDTO map[string]interface{}
+
+const (
+	ErrorCodeBadMessage      = "bad-message"
+	ErrorCodeUnexpectedType  = "unexpected-type"
+	ErrorCodeSessionRejected = "session-rejected"
+	// ErrorCodeInvalidSessionConfig is sent for a session request that
+	// fails validation, the client may send a corrected one
+	ErrorCodeInvalidSessionConfig = "invalid-session-config"
+	// ErrorCodeSessionFailed is sent when a session could not be started or
+	// broke down, e.g. because the game window never showed up
+	ErrorCodeSessionFailed = "session-failed"
+)
+
+// NewMessage wraps payload into an envelope of type t.
+func NewMessage(t MessageType, payload interface{}) (*Message, error) {
+	msg := &Message{Type: t}
+	if payload == nil {
+		return msg, nil
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	msg.Payload = b
+	return msg, nil
+}
+
+// Decode unmarshals the payload of m into v.
+func (m *Message) Decode(v interface{}) error {
+	if len(m.Payload) == 0 {
+		return fmt.Errorf("%s message has no payload", m.Type)
+	}
+	return json.Unmarshal(m.Payload, v)
+}
+
+// PairRequestDTO is the body of POST /pair. Key is the long-lived key the
+// client authenticates with once the operator approved the PIN.
+type PairRequestDTO struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	PIN  string `json:"pin"`
+}
+
+type PairResponseDTO struct {
+	ClientID string `json:"client_id"`
+}
@@ -0,0 +1,275 @@
+// Package steam imports games from a local Steam installation.
+//
+// Steam lists its library folders in steamapps/libraryfolders.vdf, and every
+// installed app has a steamapps/appmanifest_<appid>.acf in its library. The
+// window and process names of a game aren't recorded anywhere, so they are
+// guessed from the game's name and the executables in its install dir.
+package steam
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/3DRX/vaporplay/config"
+)
+
+// stateFullyInstalled is the StateFlags bit of apps that are ready to play.
+const stateFullyInstalled = 4
+
+// tools are Steam apps that are installed like games but aren't playable.
+var tools = map[string]bool{
+	"228980":  true, // Steamworks Common Redistributables
+	"1070560": true, // Steam Linux Runtime 1.0 (scout)
+	"1391110": true, // Steam Linux Runtime 2.0 (soldier)
+	"1628350": true, // Steam Linux Runtime 3.0 (sniper)
+}
+
+var toolPrefixes = []string{"Proton ", "Steam Linux Runtime"}
+
+// DefaultRoot returns the first Steam installation found in the usual
+// places, or "" if there is none.
+func DefaultRoot() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	for _, root := range []string{
+		filepath.Join(home, ".steam", "steam"),
+		filepath.Join(home, ".local", "share", "Steam"),
+		filepath.Join(home, ".var", "app", "com.valvesoftware.Steam", ".local", "share", "Steam"),
+	} {
+		if _, err := os.Stat(filepath.Join(root, "steamapps", "libraryfolders.vdf")); err == nil {
+			return root
+		}
+	}
+	return ""
+}
+
+// Importer reads Steam libraries from FS, absolute paths like the ones in
+// libraryfolders.vdf are resolved relative to the root of FS. Use
+// NewImporter for the real file system, or an fs.FS of fixtures.
+type Importer struct {
+	FS fs.FS
+}
+
+func NewImporter() *Importer {
+	return &Importer{
+		FS: os.DirFS("/"),
+	}
+}
+
+func fsPath(p string) string {
+	p = strings.TrimPrefix(path.Clean(filepath.ToSlash(p)), "/")
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+// LibraryFolders returns the library folders of the Steam installation at
+// root, root itself is always one of them.
+func (i *Importer) LibraryFolders(root string) ([]string, error) {
+	f, err := i.FS.Open(fsPath(path.Join(root, "steamapps", "libraryfolders.vdf")))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	kv, err := parseVDF(f)
+	if err != nil {
+		return nil, fmt.Errorf("libraryfolders.vdf: %w", err)
+	}
+	folders := []string{root}
+	seen := map[string]bool{fsPath(root): true}
+	libraryFolders := kv.child("libraryfolders")
+	keys := make([]string, 0, len(libraryFolders.children)+len(libraryFolders.values))
+	for key := range libraryFolders.children {
+		keys = append(keys, key)
+	}
+	for key := range libraryFolders.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// the current format has a block per folder, older versions map
+		// the folder index to its path directly
+		p := libraryFolders.child(key).value("path")
+		if p == "" {
+			p = libraryFolders.value(key)
+		}
+		if p == "" || !strings.HasPrefix(filepath.ToSlash(p), "/") || seen[fsPath(p)] {
+			continue
+		}
+		seen[fsPath(p)] = true
+		folders = append(folders, p)
+	}
+	return folders, nil
+}
+
+// Import returns a game config for every game installed in the libraries of
+// the Steam installation at root.
+func (i *Importer) Import(root string) ([]config.GameConfig, error) {
+	folders, err := i.LibraryFolders(root)
+	if err != nil {
+		return nil, err
+	}
+	games := []config.GameConfig{}
+	seen := map[string]bool{}
+	for _, folder := range folders {
+		manifests, err := fs.Glob(i.FS, path.Join(fsPath(folder), "steamapps", "appmanifest_*.acf"))
+		if err != nil {
+			return nil, err
+		}
+		for _, manifest := range manifests {
+			game, ok, err := i.importManifest(folder, manifest)
+			if err != nil {
+				slog.Warn("skipping steam app manifest", "manifest", manifest, "error", err)
+				continue
+			}
+			if !ok || seen[game.GameId] {
+				continue
+			}
+			seen[game.GameId] = true
+			games = append(games, game)
+		}
+	}
+	sort.Slice(games, func(a, b int) bool {
+		return games[a].GameDisplayName < games[b].GameDisplayName
+	})
+	return games, nil
+}
+
+func isTool(appID string, name string) bool {
+	if tools[appID] {
+		return true
+	}
+	for _, prefix := range toolPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// importManifest reads an appmanifest, ok is false for apps that aren't
+// fully installed games.
+func (i *Importer) importManifest(folder string, manifest string) (config.GameConfig, bool, error) {
+	f, err := i.FS.Open(manifest)
+	if err != nil {
+		return config.GameConfig{}, false, err
+	}
+	defer f.Close()
+	kv, err := parseVDF(f)
+	if err != nil {
+		return config.GameConfig{}, false, err
+	}
+	appState := kv.child("AppState")
+	appID := appState.value("appid")
+	name := appState.value("name")
+	installDir := appState.value("installdir")
+	if appID == "" || name == "" || installDir == "" {
+		return config.GameConfig{}, false, fmt.Errorf("appid, name or installdir missing")
+	}
+	var stateFlags int
+	fmt.Sscan(appState.value("StateFlags"), &stateFlags)
+	if stateFlags&stateFullyInstalled == 0 || isTool(appID, name) {
+		return config.GameConfig{}, false, nil
+	}
+	installPath := path.Join(folder, "steamapps", "common", installDir)
+	game := config.GameConfig{
+		GameId:          appID,
+		GameWindowName:  name,
+		GameDisplayName: name,
+		GameIcon:        "",
+		InstallDir:      filepath.FromSlash(installPath),
+		EndGameCommands: []config.KillProcessCommandConfig{},
+	}
+	for _, process := range i.executables(installPath) {
+		game.EndGameCommands = append(game.EndGameCommands, config.KillProcessCommandConfig{
+			ProcessName: process,
+		})
+	}
+	return game, true, nil
+}
+
+var elfMagic = []byte{0x7f, 'E', 'L', 'F'}
+
+// executables guesses the process names of a game from the native and
+// Windows executables at the top of its install dir.
+func (i *Importer) executables(installPath string) []string {
+	entries, err := fs.ReadDir(i.FS, fsPath(installPath))
+	if err != nil {
+		return nil
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		name := entry.Name()
+		lower := strings.ToLower(name)
+		if strings.HasSuffix(lower, ".exe") {
+			if !strings.Contains(lower, "crash") && !strings.Contains(lower, "unins") {
+				names = append(names, name)
+			}
+			continue
+		}
+		if strings.Contains(name, ".so") || strings.HasSuffix(lower, ".sh") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		if i.isELF(path.Join(fsPath(installPath), name)) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (i *Importer) isELF(p string) bool {
+	f, err := i.FS.Open(p)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	magic := make([]byte, len(elfMagic))
+	if _, err := f.Read(magic); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, elfMagic)
+}
+
+// iconNames are the librarycache images of an app in order of preference,
+// newer Steam versions keep them in a directory per app.
+var iconNames = []string{
+	"%[1]s/header.jpg",
+	"%[1]s_header.jpg",
+	"%[1]s/library_600x900.jpg",
+	"%[1]s_library_600x900.jpg",
+	"%[1]s/library_capsule.jpg",
+	"%[1]s/logo.png",
+	"%[1]s_logo.png",
+}
+
+// Icon returns the path of the artwork of an app in the librarycache of the
+// Steam installation at root.
+func Icon(root string, appID string) (string, bool) {
+	if root == "" || appID == "" || strings.ContainsAny(appID, `/\.`) {
+		return "", false
+	}
+	for _, name := range iconNames {
+		p := filepath.Join(root, "appcache", "librarycache", fmt.Sprintf(name, appID))
+		if info, err := os.Stat(p); err == nil && info.Mode().IsRegular() {
+			return p, true
+		}
+	}
+	return "", false
+}
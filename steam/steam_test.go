@@ -0,0 +1,101 @@
+package steam
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/3DRX/vaporplay/config"
+)
+
+func TestLibraryFolders(t *testing.T) {
+	i := &Importer{FS: os.DirFS("testdata")}
+	folders, err := i.LibraryFolders("/steam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/steam", "/library"}
+	if !reflect.DeepEqual(folders, want) {
+		t.Errorf("got folders %v, want %v", folders, want)
+	}
+}
+
+func TestLibraryFoldersOldFormat(t *testing.T) {
+	i := &Importer{FS: fstest.MapFS{
+		"steam/steamapps/libraryfolders.vdf": {Data: []byte(`"LibraryFolders"
+{
+	"TimeNextStatsReport"	"1718236800"
+	"ContentStatsID"	"6054298723412383617"
+	"1"	"/mnt/games"
+	"2"	"/steam"
+}
+`)},
+	}}
+	folders, err := i.LibraryFolders("/steam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/steam", "/mnt/games"}
+	if !reflect.DeepEqual(folders, want) {
+		t.Errorf("got folders %v, want %v", folders, want)
+	}
+}
+
+func TestImport(t *testing.T) {
+	i := &Importer{FS: os.DirFS("testdata")}
+	games, err := i.Import("/steam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the runtime is a tool and Counter-Strike 2 is still updating
+	want := []config.GameConfig{
+		{
+			GameId:          "1145360",
+			GameWindowName:  "Hades",
+			GameDisplayName: "Hades",
+			InstallDir:      "/library/steamapps/common/Hades",
+			EndGameCommands: []config.KillProcessCommandConfig{
+				{ProcessName: "Hades.exe"},
+			},
+		},
+		{
+			GameId:          "620",
+			GameWindowName:  "Portal 2",
+			GameDisplayName: "Portal 2",
+			InstallDir:      "/steam/steamapps/common/Portal 2",
+			EndGameCommands: []config.KillProcessCommandConfig{
+				{ProcessName: "portal2.exe"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(games, want) {
+		t.Errorf("got games %+v, want %+v", games, want)
+	}
+}
+
+func TestImportMissingRoot(t *testing.T) {
+	i := &Importer{FS: os.DirFS("testdata")}
+	if _, err := i.Import("/nonexistent"); err == nil {
+		t.Error("importing a missing steam root succeeded")
+	}
+}
+
+func TestExecutables(t *testing.T) {
+	elf := append([]byte{}, elfMagic...)
+	i := &Importer{FS: fstest.MapFS{
+		"game/game.x86_64":     {Data: elf, Mode: 0755},
+		"game/libgame.so":      {Data: elf, Mode: 0755},
+		"game/launch.sh":       {Data: []byte("#!/bin/sh\n"), Mode: 0755},
+		"game/readme.txt":      {Data: []byte("readme"), Mode: 0755},
+		"game/game.pck":        {Data: elf, Mode: 0644},
+		"game/Game.exe":        {Data: []byte("MZ")},
+		"game/CrashReport.exe": {Data: []byte("MZ")},
+		"game/bin/tool":        {Data: elf, Mode: 0755},
+	}}
+	names := i.executables("/game")
+	want := []string{"Game.exe", "game.x86_64"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got executables %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,176 @@
+package steam
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// keyValues is a node of Valve's text KeyValues format, used by
+// libraryfolders.vdf and appmanifest_*.acf. Steam treats keys case
+// insensitively, so they are stored in lower case.
+type keyValues struct {
+	values   map[string]string
+	children map[string]*keyValues
+}
+
+func newKeyValues() *keyValues {
+	return &keyValues{
+		values:   map[string]string{},
+		children: map[string]*keyValues{},
+	}
+}
+
+func (kv *keyValues) value(key string) string {
+	return kv.values[strings.ToLower(key)]
+}
+
+func (kv *keyValues) child(key string) *keyValues {
+	if c, ok := kv.children[strings.ToLower(key)]; ok {
+		return c
+	}
+	return newKeyValues()
+}
+
+type vdfTokenizer struct {
+	r    *bufio.Reader
+	line int
+}
+
+const (
+	tokenString = iota
+	tokenOpen
+	tokenClose
+	tokenEOF
+)
+
+func (t *vdfTokenizer) next() (int, string, error) {
+	for {
+		c, err := t.r.ReadByte()
+		if err == io.EOF {
+			return tokenEOF, "", nil
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		switch c {
+		case '\n':
+			t.line++
+		case ' ', '\t', '\r':
+		case '{':
+			return tokenOpen, "", nil
+		case '}':
+			return tokenClose, "", nil
+		case '/':
+			// comments run to the end of the line
+			if _, err := t.r.ReadString('\n'); err != nil && err != io.EOF {
+				return 0, "", err
+			}
+			t.line++
+		case '"':
+			s, err := t.quoted()
+			return tokenString, s, err
+		default:
+			t.r.UnreadByte()
+			return tokenString, t.bare(), nil
+		}
+	}
+}
+
+func (t *vdfTokenizer) quoted() (string, error) {
+	var b strings.Builder
+	for {
+		c, err := t.r.ReadByte()
+		if err != nil {
+			return "", fmt.Errorf("line %d: unterminated string", t.line+1)
+		}
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			escaped, err := t.r.ReadByte()
+			if err != nil {
+				return "", fmt.Errorf("line %d: unterminated string", t.line+1)
+			}
+			switch escaped {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(escaped)
+			}
+		case '\n':
+			t.line++
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+func (t *vdfTokenizer) bare() string {
+	var b strings.Builder
+	for {
+		c, err := t.r.ReadByte()
+		if err != nil {
+			return b.String()
+		}
+		if strings.IndexByte(" \t\r\n{}\"", c) != -1 {
+			t.r.UnreadByte()
+			return b.String()
+		}
+		b.WriteByte(c)
+	}
+}
+
+// parseVDF parses a KeyValues document.
+func parseVDF(r io.Reader) (*keyValues, error) {
+	t := &vdfTokenizer{r: bufio.NewReader(r)}
+	root, err := parseBlock(t, true)
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+func parseBlock(t *vdfTokenizer, top bool) (*keyValues, error) {
+	kv := newKeyValues()
+	for {
+		token, key, err := t.next()
+		if err != nil {
+			return nil, err
+		}
+		switch token {
+		case tokenEOF:
+			if !top {
+				return nil, fmt.Errorf("line %d: unexpected end of file", t.line+1)
+			}
+			return kv, nil
+		case tokenClose:
+			if top {
+				return nil, fmt.Errorf("line %d: unexpected }", t.line+1)
+			}
+			return kv, nil
+		case tokenOpen:
+			return nil, fmt.Errorf("line %d: unexpected {", t.line+1)
+		}
+		token, value, err := t.next()
+		if err != nil {
+			return nil, err
+		}
+		switch token {
+		case tokenString:
+			kv.values[strings.ToLower(key)] = value
+		case tokenOpen:
+			child, err := parseBlock(t, false)
+			if err != nil {
+				return nil, err
+			}
+			kv.children[strings.ToLower(key)] = child
+		default:
+			return nil, fmt.Errorf("line %d: missing value of %q", t.line+1, key)
+		}
+	}
+}